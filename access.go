@@ -0,0 +1,43 @@
+package expvar
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// accessTracking is set to 1 by EnableAccessTracking.
+var accessTracking int32
+
+// EnableAccessTracking makes the handler count how often each variable is
+// served. The counts are available through Bucket.AccessCount and can be
+// used to find variables that nobody reads.
+func EnableAccessTracking() {
+	atomic.StoreInt32(&accessTracking, 1)
+}
+
+// accessCounts holds the number of times each variable has been served.
+type accessCounts struct {
+	counts sync.Map // map[string]*int64
+}
+
+// track counts an access of the variable name if tracking is enabled.
+func (a *accessCounts) track(name string) {
+	if atomic.LoadInt32(&accessTracking) == 0 {
+		return
+	}
+	i, ok := a.counts.Load(name)
+	if !ok {
+		i, _ = a.counts.LoadOrStore(name, new(int64))
+	}
+	atomic.AddInt64(i.(*int64), 1)
+}
+
+// AccessCount returns the number of times the variable name has been
+// served by the handler since access tracking was enabled.
+func (m *Bucket) AccessCount(name string) int64 {
+	i, ok := m.accesses.counts.Load(name)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(i.(*int64))
+}
@@ -0,0 +1,47 @@
+package expvar
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAccessCount(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests")
+	b.NewInt("errors")
+	h := HandlerFor(b)
+
+	serve(h, "/")
+	if got := b.AccessCount("requests"); got != 0 {
+		t.Errorf("AccessCount before tracking = %d, want 0", got)
+	}
+
+	EnableAccessTracking()
+	defer atomic.StoreInt32(&accessTracking, 0)
+
+	serve(h, "/")
+	w := serve(h, "/")
+	if got := b.AccessCount("requests"); got != 2 {
+		t.Errorf("AccessCount after two requests = %d, want 2", got)
+	}
+
+	// A 304 Not Modified serves no vars.
+	if w := serve(h, "/", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Fatalf("conditional request: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if got := b.AccessCount("requests"); got != 2 {
+		t.Errorf("AccessCount after a 304 = %d, want 2", got)
+	}
+
+	serve(h, "/?var=errors")
+	if got := b.AccessCount("errors"); got != 3 {
+		t.Errorf("AccessCount(%q) = %d, want 3", "errors", got)
+	}
+	if got := b.AccessCount("requests"); got != 2 {
+		t.Errorf("AccessCount(%q) after ?var=errors = %d, want 2", "requests", got)
+	}
+	if got := b.AccessCount("missing"); got != 0 {
+		t.Errorf("AccessCount(%q) = %d, want 0", "missing", got)
+	}
+}
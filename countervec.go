@@ -0,0 +1,113 @@
+package expvar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CounterVec is a set of Counters partitioned by label values, and satisfies
+// the Var interface. It is rendered as nested JSON objects, one level per
+// label, with the counters at the innermost level.
+type CounterVec struct {
+	labelNames []string
+
+	mu       sync.RWMutex
+	children map[string]*Counter // keyed by the joined label values
+	m        Map
+}
+
+func newCounterVec(labelNames []string) *CounterVec {
+	if len(labelNames) == 0 {
+		panic("expvar: CounterVec needs at least one label name")
+	}
+	return &CounterVec{
+		labelNames: append([]string(nil), labelNames...),
+		children:   make(map[string]*Counter),
+	}
+}
+
+// WithLabelValues returns the Counter for the given label values, creating
+// it if it does not exist yet. The values must be given in the order of the
+// label names the CounterVec was created with. It panics if the number of
+// values does not match the number of label names.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("expvar: CounterVec has %d label names but got %d values", len(v.labelNames), len(values)))
+	}
+
+	key := strings.Join(values, "\x00")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.children[key]; ok {
+		return c
+	}
+
+	parent := &v.m
+	for _, value := range values[:len(values)-1] {
+		child, ok := parent.Get(value).(*Map)
+		if !ok {
+			child = new(Map)
+			parent.Set(value, child)
+		}
+		parent = child
+	}
+	c = new(Counter)
+	parent.Set(values[len(values)-1], c)
+	v.children[key] = c
+	return c
+}
+
+func (v *CounterVec) String() string {
+	return v.m.String()
+}
+
+// Zero sets all counters to zero.
+func (v *CounterVec) Zero() {
+	v.m.Zero()
+}
+
+func (v *CounterVec) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *CounterVec) clone() Var {
+	c := newCounterVec(v.labelNames)
+	var copyLevel func(m *Map, values []string)
+	copyLevel = func(m *Map, values []string) {
+		m.Do(func(kv KeyValue) {
+			path := append(values[:len(values):len(values)], kv.Key)
+			switch child := kv.Value.(type) {
+			case *Map:
+				copyLevel(child, path)
+			case *Counter:
+				c.WithLabelValues(path...).Add(child.Value())
+			}
+		})
+	}
+	copyLevel(&v.m, nil)
+	return c
+}
+
+// NewCounterVec creates and publishes a CounterVec with the given label
+// names. It panics if no label names are given.
+func NewCounterVec(name string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, labelNames...)
+}
+
+func (m *Bucket) NewCounterVec(name string, labelNames ...string) *CounterVec {
+	if v, ok := m.Get(name).(*CounterVec); ok {
+		return v
+	}
+
+	v := newCounterVec(labelNames)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,52 @@
+package expvar
+
+import (
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewCounterVec("requests", "method", "code")
+
+	get := v.WithLabelValues("GET", "200")
+	get.Inc()
+	if again := v.WithLabelValues("GET", "200"); again != get {
+		t.Errorf("WithLabelValues with the same values returned a new Counter")
+	}
+	v.WithLabelValues("GET", "200").Inc()
+	v.WithLabelValues("GET", "404").Inc()
+	v.WithLabelValues("POST", "200").Add(5)
+
+	const want = `{"GET": {"200":2,"404":1}, "POST": {"200":5}}`
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+
+	v.Zero()
+	if got := get.Value(); got != 0 {
+		t.Errorf("counter after Zero = %d, want 0", got)
+	}
+}
+
+func TestCounterVecArity(t *testing.T) {
+	v := new(Bucket).NewCounterVec("requests", "method", "code")
+	for _, values := range [][]string{{"GET"}, {"GET", "200", "extra"}, nil} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithLabelValues(%q) did not panic", values)
+				}
+			}()
+			v.WithLabelValues(values...)
+		}()
+	}
+}
+
+func TestCounterVecNoLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewCounterVec without label names did not panic")
+		}
+	}()
+	new(Bucket).NewCounterVec("requests")
+}
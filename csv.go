@@ -0,0 +1,29 @@
+package expvar
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+)
+
+// CSVHandler returns an HTTP Handler that serves the numeric variables of m
+// as CSV with a name,value header row. The numeric entries of a Map are
+// listed as name.key. All other vars are skipped.
+func CSVHandler(m *Bucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "value"})
+		for _, family := range collectMetrics(m) {
+			for _, s := range family.Samples {
+				name := family.Name
+				if s.Key != "" {
+					name += "." + s.Key
+				}
+				cw.Write([]string{name, strconv.FormatFloat(s.Value, 'g', -1, 64)})
+			}
+		}
+		cw.Flush()
+	})
+}
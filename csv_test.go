@@ -0,0 +1,32 @@
+package expvar
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVHandler(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("hits,total").Set(1)
+	b.NewMap("latency").AddFloat("p99", 2.5)
+	b.NewString("version").Set("1.0")
+
+	w := serve(CSVHandler(b), "/")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q, want text/csv", ct)
+	}
+	want := "name,value\n\"hits,total\",1\nlatency.p99,2.5\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing CSV: %v", err)
+	}
+	if got := records[1]; !reflect.DeepEqual(got, []string{"hits,total", "1"}) {
+		t.Errorf("first data row = %q, want the unescaped name", got)
+	}
+}
@@ -0,0 +1,83 @@
+package expvar
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxDiffTokens is the number of snapshots a DiffHandler remembers.
+const maxDiffTokens = 64
+
+// diffTokenHeader is the response header a DiffHandler returns the token
+// for the served snapshot in.
+const diffTokenHeader = "X-Expvar-Token"
+
+// diffCache holds the most recent snapshots served by a DiffHandler, keyed
+// by the token they were issued under.
+type diffCache struct {
+	mu     sync.Mutex
+	seq    uint64
+	snaps  map[string]map[string]string
+	tokens []string // oldest first
+}
+
+// get returns the snapshot issued under token, or nil if it is unknown.
+func (c *diffCache) get(token string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snaps[token]
+}
+
+// put stores snap and returns the token it was issued under, evicting the
+// oldest snapshot if the cache is full.
+func (c *diffCache) put(snap map[string]string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	token := strconv.FormatUint(c.seq, 36)
+	if len(c.tokens) == maxDiffTokens {
+		delete(c.snaps, c.tokens[0])
+		c.tokens = c.tokens[1:]
+	}
+	c.snaps[token] = snap
+	c.tokens = append(c.tokens, token)
+	return token
+}
+
+// DiffHandler returns an HTTP Handler that serves the variables of m as a
+// JSON object, leaving out the vars whose value has not changed since the
+// response the since query parameter refers to. Every response carries a
+// token in the X-Expvar-Token header to pass as since on the next request.
+// If since is missing or no longer known all vars are served. Vars that
+// were removed since are not reported.
+func DiffHandler(m *Bucket) http.Handler {
+	c := &diffCache{snaps: make(map[string]map[string]string)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		cur := make(map[string]string)
+		m.doVisible(func(kv KeyValue) {
+			names = append(names, kv.Key)
+			cur[kv.Key] = kv.Value.String()
+		})
+
+		prev := c.get(r.URL.Query().Get("since"))
+		w.Header().Set(diffTokenHeader, c.put(cur))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		fmt.Fprintf(w, "{\n")
+		first := true
+		for _, name := range names {
+			if val, ok := prev[name]; ok && val == cur[name] {
+				continue
+			}
+			if !first {
+				fmt.Fprintf(w, ",\n")
+			}
+			first = false
+			fmt.Fprintf(w, "%s: %s", quoteJSON(name), cur[name])
+		}
+		fmt.Fprintf(w, "\n}\n")
+	})
+}
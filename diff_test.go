@@ -0,0 +1,43 @@
+package expvar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffHandler(t *testing.T) {
+	b := new(Bucket)
+	requests := b.NewInt("requests")
+	b.NewInt("errors")
+	b.NewString("version").Set("1.0")
+	h := DiffHandler(b)
+
+	w := serve(h, "/")
+	token := w.Header().Get(diffTokenHeader)
+	if token == "" {
+		t.Fatalf("no %s header in response", diffTokenHeader)
+	}
+	if got, want := decodeKeys(t, w.Body.Bytes()), []string{"errors", "requests", "version"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first response: keys = %v, want %v", got, want)
+	}
+
+	requests.Add(1)
+	w = serve(h, "/?since="+token)
+	if got, want := w.Body.String(), "{\n\"requests\": 1\n}\n"; got != want {
+		t.Errorf("second response: body = %q, want %q", got, want)
+	}
+	next := w.Header().Get(diffTokenHeader)
+	if next == "" || next == token {
+		t.Errorf("second response: token = %q, want a new token", next)
+	}
+
+	// Nothing changed since the second response.
+	if got := decodeKeys(t, serve(h, "/?since="+next).Body.Bytes()); len(got) != 0 {
+		t.Errorf("third response: keys = %v, want none", got)
+	}
+
+	// Unknown tokens serve all vars.
+	if got := decodeKeys(t, serve(h, "/?since=unknown").Body.Bytes()); len(got) != 3 {
+		t.Errorf("unknown token: keys = %v, want all 3 vars", got)
+	}
+}
@@ -0,0 +1,84 @@
+package expvar
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxETagEntries is the number of response variants an etagCache keeps.
+const maxETagEntries = 16
+
+// etagCache remembers the hash of the last response body served for each
+// variant of a request, and the time that body was first served.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]*etagEntry
+}
+
+type etagEntry struct {
+	sum      uint64
+	tag      string
+	modified time.Time
+}
+
+// lookup returns the ETag of body and the time it was first served for
+// variant.
+func (c *etagCache) lookup(variant string, body []byte) (string, time.Time) {
+	h := fnv.New64a()
+	h.Write(body)
+	sum := h.Sum64()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[variant]; ok && e.sum == sum {
+		return e.tag, e.modified
+	}
+
+	e := &etagEntry{
+		sum: sum,
+		// The tag is weak, since it is shared by the gzip compressed and
+		// the identity encoding of the body.
+		tag:      fmt.Sprintf(`W/"%x"`, sum),
+		modified: time.Now().UTC().Truncate(time.Second),
+	}
+	if c.entries == nil || len(c.entries) >= maxETagEntries {
+		c.entries = make(map[string]*etagEntry)
+	}
+	c.entries[variant] = e
+	return e.tag, e.modified
+}
+
+// isConditional reports whether r carries a header that can make it a
+// conditional request.
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// notModified reports whether the conditional headers of r match a
+// response with the given ETag and modification time. If-None-Match takes
+// precedence over If-Modified-Since.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(tag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.After(t)
+	}
+	return false
+}
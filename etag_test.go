@@ -0,0 +1,96 @@
+package expvar
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHandlerETag(t *testing.T) {
+	b := new(Bucket)
+	x := b.NewInt("x")
+	h := HandlerFor(b)
+
+	w := serve(h, "/")
+	tag := w.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("no ETag header")
+	}
+	if w := serve(h, "/", "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	x.Add(1)
+	w = serve(h, "/", "If-None-Match", tag)
+	if w.Code != http.StatusOK {
+		t.Errorf("changed: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("ETag"); got == tag {
+		t.Errorf("changed: ETag = %s, want a new tag", got)
+	}
+
+	// Every variant of the response has its own tag.
+	if got := serve(h, "/?pretty=1").Header().Get("ETag"); got == w.Header().Get("ETag") {
+		t.Errorf("indented ETag = %s, want it to differ from the compact one", got)
+	}
+}
+
+func TestHandlerNotModifiedKeepsDelta(t *testing.T) {
+	b := new(Bucket)
+	d := b.NewDeltaInt("requests")
+	h := HandlerFor(b)
+
+	d.Add(5)
+	if w := serve(h, "/", "If-None-Match", "*"); w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if got := d.Value(); got != 5 {
+		t.Errorf("d.Value() after 304 = %d, want 5", got)
+	}
+
+	w := serve(h, "/", "If-None-Match", `W/"stale"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Body.String(), "{\n\"requests\": 5\n}\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if got := d.Value(); got != 0 {
+		t.Errorf("d.Value() after 200 = %d, want 0", got)
+	}
+}
+
+func TestETagCache(t *testing.T) {
+	var c etagCache
+	tag, modified := c.lookup("a", []byte("one"))
+
+	if got, gotModified := c.lookup("a", []byte("one")); got != tag || !gotModified.Equal(modified) {
+		t.Errorf("same body: lookup = %s, %v, want %s, %v", got, gotModified, tag, modified)
+	}
+	if got, _ := c.lookup("b", []byte("one")); got != tag {
+		t.Errorf("same body in another variant: tag = %s, want %s", got, tag)
+	}
+	if got, _ := c.lookup("a", []byte("two")); got == tag {
+		t.Errorf("new body: tag = %s, want a new tag", got)
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		since string
+		want  bool
+	}{
+		{modified.Format(http.TimeFormat), true},
+		{modified.Add(time.Hour).Format(http.TimeFormat), true},
+		{modified.Add(-time.Hour).Format(http.TimeFormat), false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("If-Modified-Since", tt.since)
+		if got := notModified(r, `W/"x"`, modified); got != tt.want {
+			t.Errorf("If-Modified-Since %q: notModified = %v, want %v", tt.since, got, tt.want)
+		}
+	}
+}
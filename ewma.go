@@ -0,0 +1,82 @@
+package expvar
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// EWMA is an exponentially weighted moving average variable that satisfies
+// the Var interface. It is rendered as the current smoothed value.
+//
+// The zero value has no smoothing factor and never moves from 0; create an
+// EWMA with NewEWMA or Bucket.NewEWMA.
+type EWMA struct {
+	f     uint64 // NaN until the first update
+	alpha float64
+}
+
+func newEWMA(alpha float64) *EWMA {
+	if !(alpha > 0 && alpha <= 1) {
+		panic("expvar: EWMA alpha must be in (0, 1]")
+	}
+	return &EWMA{f: math.Float64bits(math.NaN()), alpha: alpha}
+}
+
+// Update folds value into the moving average. The first update sets the
+// average to value.
+func (v *EWMA) Update(value float64) {
+	for {
+		cur := atomic.LoadUint64(&v.f)
+		curVal := math.Float64frombits(cur)
+		nxtVal := value
+		if !math.IsNaN(curVal) {
+			nxtVal = curVal + v.alpha*(value-curVal)
+		}
+		nxt := math.Float64bits(nxtVal)
+		if atomic.CompareAndSwapUint64(&v.f, cur, nxt) {
+			return
+		}
+	}
+}
+
+// Rate returns the current moving average, or 0 if no value has been added.
+func (v *EWMA) Rate() float64 {
+	f := math.Float64frombits(atomic.LoadUint64(&v.f))
+	if math.IsNaN(f) {
+		return 0
+	}
+	return f
+}
+
+func (v *EWMA) String() string {
+	return formatFloat(v.Rate())
+}
+
+// NumericValue returns the current moving average.
+func (v *EWMA) NumericValue() float64 {
+	return v.Rate()
+}
+
+func (v *EWMA) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *EWMA) clone() Var {
+	return &EWMA{f: atomic.LoadUint64(&v.f), alpha: v.alpha}
+}
+
+// NewEWMA creates and publishes an EWMA with smoothing factor alpha. It
+// panics if alpha is not in (0, 1].
+func NewEWMA(name string, alpha float64) *EWMA {
+	return Default.NewEWMA(name, alpha)
+}
+
+func (m *Bucket) NewEWMA(name string, alpha float64) *EWMA {
+	if v, ok := m.Get(name).(*EWMA); ok {
+		return v
+	}
+
+	v := newEWMA(alpha)
+	m.publishNew(name, v)
+	return v
+}
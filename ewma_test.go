@@ -0,0 +1,35 @@
+package expvar
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEWMAConverges(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewEWMA("load", 0.1)
+	if got := v.String(); got != "0" {
+		t.Errorf("v.String() before Update = %s, want 0", got)
+	}
+
+	v.Update(0)
+	for i := 0; i < 200; i++ {
+		v.Update(10)
+	}
+	if got := v.Rate(); math.Abs(got-10) > 0.01 {
+		t.Errorf("v.Rate() = %v, want 10 within 0.01", got)
+	}
+}
+
+func TestEWMAInvalidAlpha(t *testing.T) {
+	for _, alpha := range []float64{0, -1, 1.5, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewEWMA with alpha %v did not panic", alpha)
+				}
+			}()
+			new(Bucket).NewEWMA("load", alpha)
+		}()
+	}
+}
@@ -1,18 +1,23 @@
 package expvar
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 // Var is an abstract type for all exported variables.
@@ -32,6 +37,11 @@ func (v *Int) Value() int64 {
 	return atomic.LoadInt64(&v.i)
 }
 
+// NumericValue returns the value of v as a float64.
+func (v *Int) NumericValue() float64 {
+	return float64(v.Value())
+}
+
 func (v *Int) String() string {
 	return strconv.FormatInt(atomic.LoadInt64(&v.i), 10)
 }
@@ -48,14 +58,146 @@ func (v *Int) Add(delta int64) {
 	atomic.AddInt64(&v.i, delta)
 }
 
+// AddChecked adds delta to v and returns the new value and true, unless the
+// addition would overflow. In that case v is left unchanged and its current
+// value is returned with false.
+func (v *Int) AddChecked(delta int64) (int64, bool) {
+	for {
+		cur := atomic.LoadInt64(&v.i)
+		nxt := cur + delta
+		if (delta > 0 && nxt < cur) || (delta < 0 && nxt > cur) {
+			return cur, false
+		}
+		if atomic.CompareAndSwapInt64(&v.i, cur, nxt) {
+			return nxt, true
+		}
+	}
+}
+
 func (v *Int) Set(value int64) {
 	atomic.StoreInt64(&v.i, value)
 }
 
+// Swap sets v to new and returns the previous value.
+func (v *Int) Swap(new int64) int64 {
+	return atomic.SwapInt64(&v.i, new)
+}
+
+// CompareAndSwap sets v to new only if its current value is old, and
+// reports whether the swap took place.
+func (v *Int) CompareAndSwap(old, new int64) bool {
+	return atomic.CompareAndSwapInt64(&v.i, old, new)
+}
+
+// Max sets v to value if value is greater than the current value.
+func (v *Int) Max(value int64) {
+	for {
+		cur := atomic.LoadInt64(&v.i)
+		if value <= cur {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&v.i, cur, value) {
+			return
+		}
+	}
+}
+
+// Min sets v to value if value is less than the current value.
+func (v *Int) Min(value int64) {
+	for {
+		cur := atomic.LoadInt64(&v.i)
+		if value >= cur {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&v.i, cur, value) {
+			return
+		}
+	}
+}
+
+// Zero sets v to zero.
+func (v *Int) Zero() {
+	v.Set(0)
+}
+
 func (v *Int) MarshalJSON() ([]byte, error) {
 	return json.Marshal(v.Value())
 }
 
+// Resettable is implemented by vars that can be reset to their zero value.
+type Resettable interface {
+	Zero()
+}
+
+// Snapshotter is implemented by vars that want to control the value the
+// handler serves. The handler serves the String of the Var returned by
+// Snapshot instead of the String of the var itself. The String of the var
+// itself should render the value Snapshot would return, since the handler
+// uses it to answer conditional requests without taking a snapshot.
+type Snapshotter interface {
+	Snapshot() Var
+}
+
+// Numeric is implemented by vars that have a numeric value, such as Int,
+// Float, Gauge and Counter.
+type Numeric interface {
+	NumericValue() float64
+}
+
+// AsFloat returns the numeric value of v and true if v implements Numeric,
+// or 0 and false otherwise.
+func AsFloat(v Var) (float64, bool) {
+	if n, ok := v.(Numeric); ok {
+		return n.NumericValue(), true
+	}
+	return 0, false
+}
+
+// DeltaInt is a 64-bit integer variable that satisfies the Var and
+// Snapshotter interfaces. The handler serves the value accumulated since
+// the previous time it was served, and resets it to zero.
+type DeltaInt struct {
+	i int64
+}
+
+// Value returns the value accumulated since the last Snapshot, without
+// resetting it.
+func (v *DeltaInt) Value() int64 {
+	return atomic.LoadInt64(&v.i)
+}
+
+func (v *DeltaInt) String() string {
+	return strconv.FormatInt(atomic.LoadInt64(&v.i), 10)
+}
+
+// NumericValue returns the value accumulated so far as a float64, without
+// resetting it.
+func (v *DeltaInt) NumericValue() float64 {
+	return float64(v.Value())
+}
+
+func (v *DeltaInt) Increment() {
+	atomic.AddInt64(&v.i, 1)
+}
+
+func (v *DeltaInt) Add(delta int64) {
+	atomic.AddInt64(&v.i, delta)
+}
+
+// Snapshot returns the accumulated value as an *Int and resets v to zero.
+func (v *DeltaInt) Snapshot() Var {
+	return &Int{i: atomic.SwapInt64(&v.i, 0)}
+}
+
+// Zero sets v to zero.
+func (v *DeltaInt) Zero() {
+	atomic.StoreInt64(&v.i, 0)
+}
+
+func (v *DeltaInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value())
+}
+
 // Float is a 64-bit float variable that satisfies the Var interface.
 type Float struct {
 	f uint64
@@ -65,19 +207,81 @@ func (v *Float) Value() float64 {
 	return math.Float64frombits(atomic.LoadUint64(&v.f))
 }
 
+// NumericValue returns the value of v.
+func (v *Float) NumericValue() float64 {
+	return v.Value()
+}
+
+// String implements the Var interface. NaN and infinite values are
+// rendered as null, since JSON cannot represent them.
 func (v *Float) String() string {
-	return strconv.FormatFloat(
-		math.Float64frombits(atomic.LoadUint64(&v.f)), 'g', -1, 64)
+	return formatFloat(v.Value())
+}
+
+// quoteJSON returns s as a JSON string. Unlike %q it follows the escaping
+// rules of JSON, so any key is rendered as valid JSON.
+func quoteJSON(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// formatFloat formats f as a JSON number, or null if f is NaN or infinite.
+func formatFloat(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "null"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
 }
 
 // Add adds delta to v.
 func (v *Float) Add(delta float64) {
+	v.add(delta)
+}
+
+// add adds delta to v and returns the new value.
+func (v *Float) add(delta float64) float64 {
 	for {
 		cur := atomic.LoadUint64(&v.f)
 		curVal := math.Float64frombits(cur)
 		nxtVal := curVal + delta
 		nxt := math.Float64bits(nxtVal)
 		if atomic.CompareAndSwapUint64(&v.f, cur, nxt) {
+			return nxtVal
+		}
+	}
+}
+
+// Max sets v to value if value is greater than the current value. NaN
+// values are ignored.
+func (v *Float) Max(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	for {
+		cur := atomic.LoadUint64(&v.f)
+		curVal := math.Float64frombits(cur)
+		if value <= curVal {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&v.f, cur, math.Float64bits(value)) {
+			return
+		}
+	}
+}
+
+// Min sets v to value if value is less than the current value. NaN values
+// are ignored.
+func (v *Float) Min(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	for {
+		cur := atomic.LoadUint64(&v.f)
+		curVal := math.Float64frombits(cur)
+		if value >= curVal {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&v.f, cur, math.Float64bits(value)) {
 			return
 		}
 	}
@@ -88,7 +292,244 @@ func (v *Float) Set(value float64) {
 	atomic.StoreUint64(&v.f, math.Float64bits(value))
 }
 
+// Zero sets v to zero.
+func (v *Float) Zero() {
+	v.Set(0)
+}
+
 func (v *Float) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// Gauge is a 64-bit float variable that satisfies the Var interface. It
+// reports the value it was last set to. NaN and infinite values are
+// rendered as null, since JSON cannot represent them.
+type Gauge struct {
+	f uint64
+}
+
+func (v *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.f))
+}
+
+// NumericValue returns the value of v.
+func (v *Gauge) NumericValue() float64 {
+	return v.Value()
+}
+
+func (v *Gauge) String() string {
+	return formatFloat(v.Value())
+}
+
+// Inc increments v by one.
+func (v *Gauge) Inc() {
+	v.Add(1)
+}
+
+// Dec decrements v by one.
+func (v *Gauge) Dec() {
+	v.Add(-1)
+}
+
+// Add adds delta to v.
+func (v *Gauge) Add(delta float64) {
+	for {
+		cur := atomic.LoadUint64(&v.f)
+		curVal := math.Float64frombits(cur)
+		nxtVal := curVal + delta
+		nxt := math.Float64bits(nxtVal)
+		if atomic.CompareAndSwapUint64(&v.f, cur, nxt) {
+			return
+		}
+	}
+}
+
+// Set sets v to value.
+func (v *Gauge) Set(value float64) {
+	atomic.StoreUint64(&v.f, math.Float64bits(value))
+}
+
+// Zero sets v to zero.
+func (v *Gauge) Zero() {
+	v.Set(0)
+}
+
+func (v *Gauge) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// Bool is a boolean variable that satisfies the Var interface.
+type Bool struct {
+	b int32
+}
+
+func (v *Bool) Value() bool {
+	return atomic.LoadInt32(&v.b) != 0
+}
+
+func (v *Bool) String() string {
+	return strconv.FormatBool(v.Value())
+}
+
+// Set sets v to value.
+func (v *Bool) Set(value bool) {
+	var b int32
+	if value {
+		b = 1
+	}
+	atomic.StoreInt32(&v.b, b)
+}
+
+// Toggle flips the value of v.
+func (v *Bool) Toggle() {
+	for {
+		cur := atomic.LoadInt32(&v.b)
+		if atomic.CompareAndSwapInt32(&v.b, cur, cur^1) {
+			return
+		}
+	}
+}
+
+func (v *Bool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value())
+}
+
+// Duration is a time.Duration variable that satisfies the Var interface.
+// It is rendered as a quoted string such as "1.5s", so unlike Int it is
+// not suitable as a numeric source for consumers doing arithmetic.
+type Duration struct {
+	d int64
+}
+
+func (v *Duration) Value() time.Duration {
+	return time.Duration(atomic.LoadInt64(&v.d))
+}
+
+func (v *Duration) String() string {
+	return strconv.Quote(v.Value().String())
+}
+
+// Add adds delta to v.
+func (v *Duration) Add(delta time.Duration) {
+	atomic.AddInt64(&v.d, int64(delta))
+}
+
+// Set sets v to value.
+func (v *Duration) Set(value time.Duration) {
+	atomic.StoreInt64(&v.d, int64(value))
+}
+
+// Zero sets v to zero.
+func (v *Duration) Zero() {
+	v.Set(0)
+}
+
+func (v *Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value().String())
+}
+
+// Timestamp is a time variable that satisfies the Var interface. It is
+// rendered as a quoted RFC 3339 string with nanosecond precision.
+type Timestamp struct {
+	t uint64 // Unix nanoseconds offset by 1<<63, 0 if unset
+}
+
+// timestampOffset maps the int64 Unix nanoseconds stored in a Timestamp to
+// uint64 values, such that only math.MinInt64 maps to the unset value 0.
+const timestampOffset = 1 << 63
+
+var (
+	// minTimestamp and maxTimestamp are the earliest and latest times a
+	// Timestamp can hold, in the years 1677 and 2262.
+	minTimestamp = time.Unix(0, math.MinInt64+1)
+	maxTimestamp = time.Unix(0, math.MaxInt64)
+)
+
+// Value returns the stored time, or the zero time if v has not been set.
+func (v *Timestamp) Value() time.Time {
+	n := atomic.LoadUint64(&v.t)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(n-timestampOffset))
+}
+
+func (v *Timestamp) String() string {
+	return strconv.Quote(v.Value().Format(time.RFC3339Nano))
+}
+
+// Set sets v to t. Setting the zero time makes v unset again. Times before
+// 1677 or after 2262, which cannot be represented as int64 Unix
+// nanoseconds, are clamped to that range.
+func (v *Timestamp) Set(t time.Time) {
+	switch {
+	case t.IsZero():
+		atomic.StoreUint64(&v.t, 0)
+		return
+	case t.Before(minTimestamp):
+		t = minTimestamp
+	case t.After(maxTimestamp):
+		t = maxTimestamp
+	}
+	atomic.StoreUint64(&v.t, uint64(t.UnixNano())+timestampOffset)
+}
+
+// SetNow sets v to the current time.
+func (v *Timestamp) SetNow() {
+	v.Set(time.Now())
+}
+
+func (v *Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// Counter is a monotonically increasing 64-bit unsigned integer variable
+// that satisfies the Var interface. Unlike Int it cannot be decremented or
+// set; it can only be reset to zero.
+type Counter struct {
+	c uint64
+}
+
+func (v *Counter) Value() uint64 {
+	return atomic.LoadUint64(&v.c)
+}
+
+// NumericValue returns the value of v as a float64.
+func (v *Counter) NumericValue() float64 {
+	return float64(v.Value())
+}
+
+func (v *Counter) String() string {
+	return strconv.FormatUint(atomic.LoadUint64(&v.c), 10)
+}
+
+// Inc increments v by one.
+func (v *Counter) Inc() {
+	atomic.AddUint64(&v.c, 1)
+}
+
+// Add adds delta to v.
+func (v *Counter) Add(delta uint64) {
+	atomic.AddUint64(&v.c, delta)
+}
+
+// Reset sets v to zero and returns the value it had before.
+func (v *Counter) Reset() uint64 {
+	return atomic.SwapUint64(&v.c, 0)
+}
+
+// Drain sets v to zero and returns the count accumulated since the previous
+// Drain. Every increment is returned by exactly one Drain.
+func (v *Counter) Drain() uint64 {
+	return atomic.SwapUint64(&v.c, 0)
+}
+
+// Zero sets v to zero.
+func (v *Counter) Zero() {
+	v.Reset()
+}
+
+func (v *Counter) MarshalJSON() ([]byte, error) {
 	return json.Marshal(v.Value())
 }
 
@@ -96,7 +537,12 @@ func (v *Float) MarshalJSON() ([]byte, error) {
 type Map struct {
 	m      sync.Map // map[string]Var
 	keysMu sync.RWMutex
-	keys   []string // sorted
+	keys   []string // sorted, copy-on-write
+	added  []string // in insertion order, copy-on-write
+
+	onNewKey []func(key string) // guarded by keysMu
+
+	kind VarKind // kind of the values, KindAny if untyped
 }
 
 func (v *Map) String() string {
@@ -104,16 +550,16 @@ func (v *Map) String() string {
 	fmt.Fprintf(&b, "{")
 	first := true
 	v.Do(func(kv KeyValue) {
-		if !first {
-			fmt.Fprintf(&b, ", ")
-		}
-
 		val, err := json.Marshal(kv.Value)
 		if err != nil {
 			return
 		}
 
-		fmt.Fprintf(&b, "%q: ", kv.Key)
+		if !first {
+			fmt.Fprintf(&b, ", ")
+		}
+
+		fmt.Fprintf(&b, "%s: ", quoteJSON(kv.Key))
 
 		b.Write(val)
 
@@ -123,11 +569,16 @@ func (v *Map) String() string {
 	return b.String()
 }
 
+func (v *Map) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
 // Init removes all keys from the map.
 func (v *Map) Init() *Map {
 	v.keysMu.Lock()
 	defer v.keysMu.Unlock()
-	v.keys = v.keys[:0]
+	v.keys = nil
+	v.added = nil
 	v.m.Range(func(k, _ interface{}) bool {
 		v.m.Delete(k)
 		return true
@@ -135,17 +586,181 @@ func (v *Map) Init() *Map {
 	return v
 }
 
+// Clear removes all keys from the map. Unlike Init, it only deletes entries
+// whose keys have been fully added, so a concurrent Add or Set never leaves
+// a key behind without a value.
+func (v *Map) Clear() {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+	for _, k := range v.keys {
+		v.m.Delete(k)
+	}
+	v.keys = nil
+	v.added = nil
+}
+
+// Zero zeroes every entry of the map that implements Resettable. The keys
+// are left in place.
+func (v *Map) Zero() {
+	v.Do(func(kv KeyValue) {
+		if r, ok := kv.Value.(Resettable); ok {
+			r.Zero()
+		}
+	})
+}
+
+// Clone returns a new Map holding copies of the entries of v. Entries of
+// the variable types of this package, including nested Maps, are deep
+// copied, so later updates to v do not affect the clone. The exceptions are
+// shared between v and the clone: Func, EncodedFunc, VarFunc,
+// RuntimeMetric and MemStatsField compute their value on each call, Struct
+// and Rate report on state held elsewhere, and vars of other packages are
+// not known to Clone.
+func (v *Map) Clone() *Map {
+	c := &Map{kind: v.kind}
+	v.Do(func(kv KeyValue) {
+		c.Set(kv.Key, cloneVar(kv.Value))
+	})
+	return c
+}
+
+// cloner is implemented by the variable types of this package that are
+// copied by Clone and are not handled by cloneVar directly.
+type cloner interface {
+	clone() Var
+}
+
+// cloneVar returns a copy of the current value of v, or v itself if it is
+// not one of the variable types of this package.
+func cloneVar(v Var) Var {
+	switch v := v.(type) {
+	case *Int:
+		c := new(Int)
+		c.Set(v.Value())
+		return c
+	case *DeltaInt:
+		c := new(DeltaInt)
+		c.Add(v.Value())
+		return c
+	case *Float:
+		c := new(Float)
+		c.Set(v.Value())
+		return c
+	case *Gauge:
+		c := new(Gauge)
+		c.Set(v.Value())
+		return c
+	case *Bool:
+		c := new(Bool)
+		c.Set(v.Value())
+		return c
+	case *Duration:
+		c := new(Duration)
+		c.Set(v.Value())
+		return c
+	case *Timestamp:
+		c := &Timestamp{}
+		atomic.StoreUint64(&c.t, atomic.LoadUint64(&v.t))
+		return c
+	case *Counter:
+		c := new(Counter)
+		c.Add(v.Value())
+		return c
+	case *String:
+		c := &String{max: v.max}
+		c.Set(v.Value())
+		return c
+	case *Map:
+		return v.Clone()
+	case cloner:
+		return v.clone()
+	}
+	return v
+}
+
+// SumInt returns the sum of all *Int values in the map. Other values are
+// ignored.
+func (v *Map) SumInt() int64 {
+	var sum int64
+	v.Do(func(kv KeyValue) {
+		if iv, ok := kv.Value.(*Int); ok {
+			sum += iv.Value()
+		}
+	})
+	return sum
+}
+
+// AverageFloat returns the average of all *Float values in the map, or 0 if
+// it holds none. Other values are ignored.
+func (v *Map) AverageFloat() float64 {
+	var sum float64
+	var n int
+	v.Do(func(kv KeyValue) {
+		if fv, ok := kv.Value.(*Float); ok {
+			sum += fv.Value()
+			n++
+		}
+	})
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// Len returns the number of entries in the map.
+func (v *Map) Len() int {
+	v.keysMu.RLock()
+	defer v.keysMu.RUnlock()
+	return len(v.keys)
+}
+
+// Keys returns a sorted copy of the keys in the map.
+func (v *Map) Keys() []string {
+	v.keysMu.RLock()
+	defer v.keysMu.RUnlock()
+	keys := make([]string, len(v.keys))
+	copy(keys, v.keys)
+	return keys
+}
+
+// OnNewKey registers f to be called whenever a key is added to the map that
+// was not present before. f is called without any lock held, so it may use
+// the map.
+func (v *Map) OnNewKey(f func(key string)) {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+	v.onNewKey = append(v.onNewKey, f)
+}
+
 // addKey updates the sorted list of keys in v.keys.
+//
+// The key slices are never modified in place below their length, so
+// iterators may keep using a slice taken under the lock after releasing it.
 func (v *Map) addKey(key string) {
 	v.keysMu.Lock()
-	defer v.keysMu.Unlock()
+	added := true
 	// Using insertion sort to place key into the already-sorted v.keys.
 	if i := sort.SearchStrings(v.keys, key); i >= len(v.keys) {
 		v.keys = append(v.keys, key)
 	} else if v.keys[i] != key {
-		v.keys = append(v.keys, "")
-		copy(v.keys[i+1:], v.keys[i:])
-		v.keys[i] = key
+		keys := make([]string, len(v.keys)+1)
+		copy(keys, v.keys[:i])
+		keys[i] = key
+		copy(keys[i+1:], v.keys[i:])
+		v.keys = keys
+	} else {
+		added = false
+	}
+	if added {
+		v.added = append(v.added, key)
+	}
+	hooks := v.onNewKey
+	v.keysMu.Unlock()
+
+	if added {
+		for _, f := range hooks {
+			f(key)
+		}
 	}
 }
 
@@ -155,7 +770,132 @@ func (v *Map) Get(key string) Var {
 	return av
 }
 
+// GetInt returns the *Int stored under key. The boolean reports whether
+// the key exists and holds an *Int.
+func (v *Map) GetInt(key string) (*Int, bool) {
+	iv, ok := v.Get(key).(*Int)
+	return iv, ok
+}
+
+// GetFloat returns the *Float stored under key. The boolean reports whether
+// the key exists and holds a *Float.
+func (v *Map) GetFloat(key string) (*Float, bool) {
+	fv, ok := v.Get(key).(*Float)
+	return fv, ok
+}
+
+// GetString returns the *String stored under key. The boolean reports
+// whether the key exists and holds a *String.
+func (v *Map) GetString(key string) (*String, bool) {
+	sv, ok := v.Get(key).(*String)
+	return sv, ok
+}
+
+// SetBatch sets the values of all entries at once. Iterations of the map
+// see either all of the new values or none of them. It panics if any of
+// the values is nil or, for a typed map, not of its kind.
+func (v *Map) SetBatch(entries map[string]Var) {
+	names := make([]string, 0, len(entries))
+	for key, av := range entries {
+		v.checkValue(key, av)
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	v.keysMu.Lock()
+	var newKeys []string
+	for _, key := range names {
+		if _, loaded := v.m.Load(key); !loaded {
+			newKeys = append(newKeys, key)
+		}
+		v.m.Store(key, entries[key])
+	}
+	if len(newKeys) > 0 {
+		// Merge the sorted new keys into a fresh copy of the sorted keys.
+		keys := make([]string, 0, len(v.keys)+len(newKeys))
+		i, j := 0, 0
+		for i < len(v.keys) && j < len(newKeys) {
+			if v.keys[i] < newKeys[j] {
+				keys = append(keys, v.keys[i])
+				i++
+			} else {
+				keys = append(keys, newKeys[j])
+				j++
+			}
+		}
+		keys = append(keys, v.keys[i:]...)
+		v.keys = append(keys, newKeys[j:]...)
+		v.added = append(v.added, newKeys...)
+	}
+	hooks := v.onNewKey
+	v.keysMu.Unlock()
+
+	for _, key := range newKeys {
+		for _, f := range hooks {
+			f(key)
+		}
+	}
+}
+
+// Replace replaces the contents of v with the entries of src. The values
+// are shared, not copied. Iterations of v see either the old or the new
+// contents, never a mix of both. If v is a typed map, it panics if src holds
+// a value that is not of its kind.
+func (v *Map) Replace(src *Map) {
+	if src == v {
+		return
+	}
+	kvs := src.snapshotEntries(Insertion)
+	added := make([]string, len(kvs))
+	for i, kv := range kvs {
+		v.checkValue(kv.Key, kv.Value)
+		added[i] = kv.Key
+	}
+	keys := make([]string, len(added))
+	copy(keys, added)
+	sort.Strings(keys)
+
+	v.keysMu.Lock()
+	var newKeys []string
+	for _, kv := range kvs {
+		if _, loaded := v.m.Load(kv.Key); !loaded {
+			newKeys = append(newKeys, kv.Key)
+		}
+		v.m.Store(kv.Key, kv.Value)
+	}
+	for _, k := range v.keys {
+		if i := sort.SearchStrings(keys, k); i == len(keys) || keys[i] != k {
+			v.m.Delete(k)
+		}
+	}
+	v.keys = keys
+	v.added = added
+	hooks := v.onNewKey
+	v.keysMu.Unlock()
+
+	for _, key := range newKeys {
+		for _, f := range hooks {
+			f(key)
+		}
+	}
+}
+
+// checkValue panics if av cannot be stored under key, because it is nil or
+// does not match the kind of a typed map.
+func (v *Map) checkValue(key string, av Var) {
+	if isNilVar(av) {
+		log.Panicln("Set of nil var for map key:", key)
+	}
+	if !v.kind.accepts(av) {
+		log.Panicf("Set of %T var in map of %s for key: %s", av, v.kind, key)
+	}
+}
+
+// Set sets the value stored under key to av. It panics if av is nil, or if
+// v is a typed map and av is not of its kind.
 func (v *Map) Set(key string, av Var) {
+	v.checkValue(key, av)
+
 	// Before we store the value, check to see whether the key is new. Try a Load
 	// before LoadOrStore: LoadOrStore causes the key interface to escape even on
 	// the Load path.
@@ -169,10 +909,29 @@ func (v *Map) Set(key string, av Var) {
 	v.m.Store(key, av)
 }
 
-// Add adds delta to the *Int value stored under the given map key.
+// LoadOrStore returns the existing value for key if present. Otherwise, it
+// stores and returns av. The loaded result is true if the value was loaded,
+// false if stored. It panics if av is nil or, for a typed map, not of its
+// kind.
+func (v *Map) LoadOrStore(key string, av Var) (actual Var, loaded bool) {
+	v.checkValue(key, av)
+
+	i, loaded := v.m.LoadOrStore(key, av)
+	if !loaded {
+		v.addKey(key)
+	}
+	actual, _ = i.(Var)
+	return actual, loaded
+}
+
+// Add adds delta to the *Int value stored under the given map key. In a
+// typed map of another kind no new entry is created.
 func (v *Map) Add(key string, delta int64) {
 	i, ok := v.m.Load(key)
 	if !ok {
+		if !v.kind.accepts((*Int)(nil)) {
+			return
+		}
 		var dup bool
 		i, dup = v.m.LoadOrStore(key, new(Int))
 		if !dup {
@@ -186,10 +945,36 @@ func (v *Map) Add(key string, delta int64) {
 	}
 }
 
+// AddInt adds delta to the *Int value stored under the given map key and
+// returns the new value. If the key holds a value that is not an *Int it
+// is left unchanged and 0 is returned.
+func (v *Map) AddInt(key string, delta int64) int64 {
+	i, ok := v.m.Load(key)
+	if !ok {
+		if !v.kind.accepts((*Int)(nil)) {
+			return 0
+		}
+		var dup bool
+		i, dup = v.m.LoadOrStore(key, new(Int))
+		if !dup {
+			v.addKey(key)
+		}
+	}
+
+	if iv, ok := i.(*Int); ok {
+		return atomic.AddInt64(&iv.i, delta)
+	}
+	return 0
+}
+
 // AddFloat adds delta to the *Float value stored under the given map key.
+// In a typed map of another kind no new entry is created.
 func (v *Map) AddFloat(key string, delta float64) {
 	i, ok := v.m.Load(key)
 	if !ok {
+		if !v.kind.accepts((*Float)(nil)) {
+			return
+		}
 		var dup bool
 		i, dup = v.m.LoadOrStore(key, new(Float))
 		if !dup {
@@ -203,32 +988,154 @@ func (v *Map) AddFloat(key string, delta float64) {
 	}
 }
 
+// IncrFloatBy adds delta to the *Float value stored under the given map key
+// and returns the new value, creating the *Float if the key is absent. If
+// the key holds a value that is not a *Float, or v is a typed map of
+// another kind, it is left unchanged and 0 is returned.
+func (v *Map) IncrFloatBy(key string, delta float64) float64 {
+	i, ok := v.m.Load(key)
+	if !ok {
+		if !v.kind.accepts((*Float)(nil)) {
+			return 0
+		}
+		var dup bool
+		i, dup = v.m.LoadOrStore(key, new(Float))
+		if !dup {
+			v.addKey(key)
+		}
+	}
+
+	if fv, ok := i.(*Float); ok {
+		return fv.add(delta)
+	}
+	return 0
+}
+
 // Delete deletes the given key from the map.
 func (v *Map) Delete(key string) {
 	v.keysMu.Lock()
 	defer v.keysMu.Unlock()
 	i := sort.SearchStrings(v.keys, key)
 	if i < len(v.keys) && key == v.keys[i] {
-		v.keys = append(v.keys[:i], v.keys[i+1:]...)
+		v.keys = without(v.keys, i)
+		v.removeAdded(key)
 		v.m.Delete(key)
 	}
 }
 
-// Do calls f for each entry in the map.
-// The map is locked during the iteration,
-// but existing entries may be concurrently updated.
+// DeleteFunc deletes every entry of the map for which pred returns true.
+// The map is locked during the whole pass, so pred must not use the map.
+func (v *Map) DeleteFunc(pred func(KeyValue) bool) {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+	keys := make([]string, 0, len(v.keys))
+	for _, k := range v.keys {
+		i, _ := v.m.Load(k)
+		av, _ := i.(Var)
+		if av == nil {
+			continue
+		}
+		if pred(KeyValue{k, av}) {
+			v.m.Delete(k)
+			v.removeAdded(k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	v.keys = keys
+}
+
+// removeAdded removes key from the insertion ordered keys. The caller must
+// hold keysMu.
+func (v *Map) removeAdded(key string) {
+	for i, k := range v.added {
+		if k == key {
+			v.added = without(v.added, i)
+			return
+		}
+	}
+}
+
+// without returns a copy of keys with the element at index i removed.
+func without(keys []string, i int) []string {
+	c := make([]string, 0, len(keys)-1)
+	c = append(c, keys[:i]...)
+	return append(c, keys[i+1:]...)
+}
+
+// snapshotEntries returns the current entries of the map in the given
+// order. The read lock is only held while the entries are collected, which
+// makes the result consistent with respect to SetBatch.
+func (v *Map) snapshotEntries(order SortOrder) []KeyValue {
+	v.keysMu.RLock()
+	defer v.keysMu.RUnlock()
+	keys := v.keys
+	if order == Insertion {
+		keys = v.added
+	}
+	kvs := make([]KeyValue, 0, len(keys))
+	for _, k := range keys {
+		i, _ := v.m.Load(k)
+		if av, _ := i.(Var); av != nil {
+			kvs = append(kvs, KeyValue{k, av})
+		}
+	}
+	return kvs
+}
+
+// visit calls f for each entry of kvs that is still present in the map,
+// until f returns false.
+func (v *Map) visit(kvs []KeyValue, f func(KeyValue) bool) {
+	for _, kv := range kvs {
+		if _, ok := v.m.Load(kv.Key); !ok {
+			continue
+		}
+		if !f(kv) {
+			return
+		}
+	}
+}
+
+// SortOrder selects the order in which Map.DoOrdered visits entries.
+type SortOrder int
+
+const (
+	// Sorted visits entries in sorted key order, like Do.
+	Sorted SortOrder = iota
+	// Insertion visits entries in the order their keys were added.
+	Insertion
+)
+
+// DoOrdered calls f for each entry in the map, in the given order.
+// It iterates over a snapshot of the entries, so f may use the map. Entries
+// deleted during the iteration are skipped, entries added are not visited.
+func (v *Map) DoOrdered(order SortOrder, f func(KeyValue)) {
+	v.visit(v.snapshotEntries(order), func(kv KeyValue) bool {
+		f(kv)
+		return true
+	})
+}
+
+// DoWhile calls f for each entry in the map, in sorted key order, until f
+// returns false. Like Do, it iterates over a snapshot of the entries.
+func (v *Map) DoWhile(f func(KeyValue) bool) {
+	v.visit(v.snapshotEntries(Sorted), f)
+}
+
+// Do calls f for each entry in the map, in sorted key order.
+// The lock is only held while the entries are snapshotted, so writers are
+// not blocked by a slow f and f may use the map. Entries deleted during the
+// iteration are skipped, entries added are not visited. The values of a
+// SetBatch are either all seen or none are.
 func (v *Map) Do(f func(KeyValue)) {
-	v.keysMu.RLock()
-	defer v.keysMu.RUnlock()
-	for _, k := range v.keys {
-		i, _ := v.m.Load(k)
-		f(KeyValue{k, i.(Var)})
-	}
+	v.DoOrdered(Sorted, f)
 }
 
 // String is a string variable, and satisfies the Var interface.
 type String struct {
-	s atomic.Value // string
+	mu  sync.Mutex   // serializes Set and Append
+	s   atomic.Value // string
+	max int          // maximum length in bytes, 0 if unbounded
 }
 
 func (v *String) Value() string {
@@ -244,8 +1151,39 @@ func (v *String) String() string {
 	return string(b)
 }
 
+// Set sets v to value. If v has a maximum length, a longer value is
+// truncated; see NewBoundedString.
 func (v *String) Set(value string) {
-	v.s.Store(value)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.s.Store(v.truncate(value))
+}
+
+// truncatedSuffix is appended to values cut off by a bounded String.
+const truncatedSuffix = "...(truncated)"
+
+// truncate returns value cut to the maximum length of v, at a rune boundary,
+// with truncatedSuffix appended. It returns value as is if it fits or v is
+// unbounded.
+func (v *String) truncate(value string) string {
+	if v.max <= 0 || len(value) <= v.max {
+		return value
+	}
+	i := v.max
+	for i > 0 && !utf8.RuneStart(value[i]) {
+		i--
+	}
+	return value[:i] + truncatedSuffix
+}
+
+// Append appends s to the value of v and returns the new value. If v has a
+// maximum length, the result is truncated like in Set.
+func (v *String) Append(s string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	nxt := v.truncate(v.Value() + s)
+	v.s.Store(nxt)
+	return nxt
 }
 
 func (v *String) MarshalJSON() ([]byte, error) {
@@ -259,24 +1197,246 @@ type Bucket struct {
 
 	varKeysMu sync.RWMutex
 	varKeys   []string // sorted
+
+	subsMu sync.Mutex
+	subs   map[chan string]struct{}
+
+	etags    etagCache
+	accesses accessCounts
 }
 
 func Publish(name string, v Var) {
 	Default.Publish(name, v)
 }
 
+var (
+	// ErrDuplicateKey is returned by TryPublish when the name is already
+	// registered.
+	ErrDuplicateKey = errors.New("expvar: reuse of exported var name")
+
+	// ErrNilVar is returned by TryPublish when the var is nil.
+	ErrNilVar = errors.New("expvar: publish of nil var")
+)
+
 // Publish declares a named exported variable. This should be called from a
 // package's init function when it creates its Vars. If the name is already
-// registered then this will log.Panic.
+// registered or v is nil then this will log.Panic.
 func (m *Bucket) Publish(name string, v Var) {
-	if _, dup := m.vars.LoadOrStore(name, v); dup {
+	switch err := m.TryPublish(name, v); err {
+	case ErrDuplicateKey:
+		log.Panicln("Reuse of exported var name:", name)
+	case ErrNilVar:
+		log.Panicln("Publish of nil var:", name)
+	}
+}
+
+// Alias publishes the existing variable v under name, typically in a
+// second bucket. The same var is then visible in both places, so updates
+// made through one are seen through the other and nothing is counted
+// twice. Aliasing a name to the var it already holds is a no-op; if it
+// holds another var, or v is nil, Alias panics like Publish.
+func (m *Bucket) Alias(name string, v Var) {
+	err := m.TryPublish(name, v)
+	if err == ErrDuplicateKey && sameVar(m.Get(name), v) {
+		return
+	}
+	switch err {
+	case ErrDuplicateKey:
+		log.Panicln("Reuse of exported var name:", name)
+	case ErrNilVar:
+		log.Panicln("Publish of nil var:", name)
+	}
+}
+
+// sameVar reports whether a and b are the same variable. Vars of types
+// that cannot be compared, such as Func, are never the same.
+func sameVar(a, b Var) bool {
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// TypeMismatchError is returned by LoadOrPublish, and the panic value of
+// the NewX functions, when a name is already published with a var of
+// another type than the one asked for.
+type TypeMismatchError struct {
+	Name string // name of the var
+	Have string // type of the published var, like "*expvar.Int"
+	Want string // type asked for
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("expvar: var %q has type %s, not %s", e.Name, e.Have, e.Want)
+}
+
+func LoadOrPublish(name string, v Var) (Var, error) {
+	return Default.LoadOrPublish(name, v)
+}
+
+// LoadOrPublish returns the var published under name if it has the same
+// type as v. If name is not registered, it publishes v and returns it.
+// Unlike the NewX functions it does not panic, but returns a
+// *TypeMismatchError if name holds a var of another type, and ErrNilVar if
+// v is nil.
+func (m *Bucket) LoadOrPublish(name string, v Var) (Var, error) {
+	for {
+		err := m.TryPublish(name, v)
+		if err != ErrDuplicateKey {
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+		if err := m.typeMismatch(name, v); err != nil {
+			return nil, err
+		}
+		if have := m.Get(name); have != nil {
+			return have, nil
+		}
+		// Unpublished in the meantime; try again.
+	}
+}
+
+// typeMismatch returns a *TypeMismatchError if name holds a value of
+// another type than v, and nil if it holds one of the same type or none.
+func (m *Bucket) typeMismatch(name string, v Var) error {
+	i, ok := m.vars.Load(name)
+	if !ok || reflect.TypeOf(i) == reflect.TypeOf(v) {
+		return nil
+	}
+	return &TypeMismatchError{
+		Name: name,
+		Have: reflect.TypeOf(i).String(),
+		Want: reflect.TypeOf(v).String(),
+	}
+}
+
+// publishNew publishes v, which a NewX method created for name after
+// finding no var of its type there. If name holds a var of another type it
+// panics with a *TypeMismatchError, otherwise it panics like Publish.
+func (m *Bucket) publishNew(name string, v Var) {
+	switch err := m.TryPublish(name, v); err {
+	case ErrDuplicateKey:
+		if err := m.typeMismatch(name, v); err != nil {
+			panic(err)
+		}
 		log.Panicln("Reuse of exported var name:", name)
+	case ErrNilVar:
+		log.Panicln("Publish of nil var:", name)
+	}
+}
+
+func TryPublish(name string, v Var) error {
+	return Default.TryPublish(name, v)
+}
+
+// TryPublish declares a named exported variable like Publish, but returns
+// ErrDuplicateKey instead of panicking if the name is already registered.
+// The existing variable is left untouched in that case. If v is nil it
+// returns ErrNilVar.
+func (m *Bucket) TryPublish(name string, v Var) error {
+	if isNilVar(v) {
+		return ErrNilVar
 	}
 
+	// Hold varKeysMu across the store so a concurrent Unpublish cannot
+	// remove the var before its name has been added to varKeys.
 	m.varKeysMu.Lock()
 	defer m.varKeysMu.Unlock()
+	if _, dup := m.vars.LoadOrStore(name, v); dup {
+		return ErrDuplicateKey
+	}
+
 	m.varKeys = append(m.varKeys, name)
 	sort.Strings(m.varKeys)
+	m.notify(name)
+	return nil
+}
+
+// Merge publishes every variable of other in m under its name prefixed
+// with prefix. Names that are already registered in m are skipped. The
+// variables are shared, not copied.
+func (m *Bucket) Merge(other *Bucket, prefix string) {
+	var kvs []KeyValue
+	other.Do(func(kv KeyValue) {
+		kvs = append(kvs, kv)
+	})
+
+	m.varKeysMu.Lock()
+	defer m.varKeysMu.Unlock()
+	for _, kv := range kvs {
+		name := prefix + kv.Key
+		if _, dup := m.vars.LoadOrStore(name, kv.Value); dup {
+			continue
+		}
+		m.varKeys = append(m.varKeys, name)
+		m.notify(name)
+	}
+	sort.Strings(m.varKeys)
+}
+
+// PublishAll publishes all vars at once, sorting the names of m only a
+// single time. If any of the names is already registered, or any of the
+// vars is nil, an error naming it is returned and m is left unchanged.
+func (m *Bucket) PublishAll(vars map[string]Var) error {
+	names := make([]string, 0, len(vars))
+	for name, v := range vars {
+		if isNilVar(v) {
+			return fmt.Errorf("%w: %q", ErrNilVar, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m.varKeysMu.Lock()
+	defer m.varKeysMu.Unlock()
+	for _, name := range names {
+		if _, dup := m.vars.Load(name); dup {
+			return fmt.Errorf("%w: %q", ErrDuplicateKey, name)
+		}
+	}
+	for _, name := range names {
+		m.vars.Store(name, vars[name])
+		m.varKeys = append(m.varKeys, name)
+	}
+	sort.Strings(m.varKeys)
+	for _, name := range names {
+		m.notify(name)
+	}
+	return nil
+}
+
+func Reset() {
+	Default.Reset()
+}
+
+// Reset zeroes all exported variables that implement Resettable, such as
+// Int, Float, Counter and Map. Other vars are left alone, and all vars stay
+// registered.
+func (m *Bucket) Reset() {
+	m.Do(func(kv KeyValue) {
+		if r, ok := kv.Value.(Resettable); ok {
+			r.Zero()
+		}
+	})
+}
+
+func Unpublish(name string) {
+	Default.Unpublish(name)
+}
+
+// Unpublish removes a named exported variable. It is a no-op if the name
+// has not been registered.
+func (m *Bucket) Unpublish(name string) {
+	m.varKeysMu.Lock()
+	defer m.varKeysMu.Unlock()
+	i := sort.SearchStrings(m.varKeys, name)
+	if i < len(m.varKeys) && name == m.varKeys[i] {
+		m.varKeys = append(m.varKeys[:i], m.varKeys[i+1:]...)
+		m.vars.Delete(name)
+		m.notify(name)
+	}
 }
 
 func Get(name string) Var {
@@ -291,17 +1451,31 @@ func (m *Bucket) Get(name string) Var {
 	return v
 }
 
+func Names() []string {
+	return Default.Names()
+}
+
+// Names returns a sorted copy of the names of all exported variables, in
+// the order used by Do.
+func (m *Bucket) Names() []string {
+	m.varKeysMu.RLock()
+	defer m.varKeysMu.RUnlock()
+	names := make([]string, len(m.varKeys))
+	copy(names, m.varKeys)
+	return names
+}
+
 func NewMap(name string) *Map {
 	return Default.NewMap(name)
 }
 
 func (m *Bucket) NewMap(name string) *Map {
-	if v := m.Get(name); v != nil {
-		return v.(*Map)
+	if v, ok := m.Get(name).(*Map); ok {
+		return v
 	}
 
 	v := new(Map)
-	m.Publish(name, v)
+	m.publishNew(name, v)
 	return v
 }
 
@@ -310,12 +1484,29 @@ func NewString(name string) *String {
 }
 
 func (m *Bucket) NewString(name string) *String {
-	if v := m.Get(name); v != nil {
-		return v.(*String)
+	if v, ok := m.Get(name).(*String); ok {
+		return v
 	}
 
 	v := new(String)
-	m.Publish(name, v)
+	m.publishNew(name, v)
+	return v
+}
+
+// NewBoundedString creates and publishes a String that holds at most
+// maxBytes bytes. Longer values are cut off at a rune boundary and get the
+// suffix "...(truncated)", which is not counted towards maxBytes.
+func NewBoundedString(name string, maxBytes int) *String {
+	return Default.NewBoundedString(name, maxBytes)
+}
+
+func (m *Bucket) NewBoundedString(name string, maxBytes int) *String {
+	if v, ok := m.Get(name).(*String); ok {
+		return v
+	}
+
+	v := &String{max: maxBytes}
+	m.publishNew(name, v)
 	return v
 }
 
@@ -324,12 +1515,12 @@ func NewInt(name string) *Int {
 }
 
 func (m *Bucket) NewInt(name string) *Int {
-	if v := m.Get(name); v != nil {
-		return v.(*Int)
+	if v, ok := m.Get(name).(*Int); ok {
+		return v
 	}
 
 	v := new(Int)
-	m.Publish(name, v)
+	m.publishNew(name, v)
 	return v
 }
 
@@ -338,12 +1529,154 @@ func NewFloat(name string) *Float {
 }
 
 func (m *Bucket) NewFloat(name string) *Float {
+	if v, ok := m.Get(name).(*Float); ok {
+		return v
+	}
+
 	v := new(Float)
-	if v := m.Get(name); v != nil {
-		return v.(*Float)
+	m.publishNew(name, v)
+	return v
+}
+
+func NewFunc(name string, f func() interface{}) Func {
+	return Default.NewFunc(name, f)
+}
+
+func (m *Bucket) NewFunc(name string, f func() interface{}) Func {
+	if v, ok := m.Get(name).(Func); ok {
+		return v
+	}
+
+	v := Func(f)
+	m.publishNew(name, v)
+	return v
+}
+
+// NewFuncWithEncoder creates and publishes a var that renders the value of
+// f with enc, for example to control the formatting of floats or disable
+// HTML escaping.
+func NewFuncWithEncoder(name string, f func() interface{}, enc func(interface{}) ([]byte, error)) Var {
+	return Default.NewFuncWithEncoder(name, f, enc)
+}
+
+func (m *Bucket) NewFuncWithEncoder(name string, f func() interface{}, enc func(interface{}) ([]byte, error)) Var {
+	if v, ok := m.Get(name).(*EncodedFunc); ok {
+		return v
+	}
+
+	v := &EncodedFunc{f: f, enc: enc}
+	m.publishNew(name, v)
+	return v
+}
+
+func NewVarFunc(name string, f func() Var) VarFunc {
+	return Default.NewVarFunc(name, f)
+}
+
+func (m *Bucket) NewVarFunc(name string, f func() Var) VarFunc {
+	if v, ok := m.Get(name).(VarFunc); ok {
+		return v
+	}
+
+	v := VarFunc(f)
+	m.publishNew(name, v)
+	return v
+}
+
+func NewBool(name string) *Bool {
+	return Default.NewBool(name)
+}
+
+func (m *Bucket) NewBool(name string) *Bool {
+	if v, ok := m.Get(name).(*Bool); ok {
+		return v
+	}
+
+	v := new(Bool)
+	m.publishNew(name, v)
+	return v
+}
+
+func NewDuration(name string) *Duration {
+	return Default.NewDuration(name)
+}
+
+func (m *Bucket) NewDuration(name string) *Duration {
+	if v, ok := m.Get(name).(*Duration); ok {
+		return v
+	}
+
+	v := new(Duration)
+	m.publishNew(name, v)
+	return v
+}
+
+func NewCounter(name string) *Counter {
+	return Default.NewCounter(name)
+}
+
+func (m *Bucket) NewCounter(name string) *Counter {
+	if v, ok := m.Get(name).(*Counter); ok {
+		return v
+	}
+
+	v := new(Counter)
+	m.publishNew(name, v)
+	return v
+}
+
+func NewGauge(name string) *Gauge {
+	return Default.NewGauge(name)
+}
+
+func (m *Bucket) NewGauge(name string) *Gauge {
+	if v, ok := m.Get(name).(*Gauge); ok {
+		return v
+	}
+
+	v := new(Gauge)
+	m.publishNew(name, v)
+	return v
+}
+
+func NewTimestamp(name string) *Timestamp {
+	return Default.NewTimestamp(name)
+}
+
+func (m *Bucket) NewTimestamp(name string) *Timestamp {
+	if v, ok := m.Get(name).(*Timestamp); ok {
+		return v
+	}
+
+	v := new(Timestamp)
+	m.publishNew(name, v)
+	return v
+}
+
+// isNilVar reports whether v is nil or holds a nil pointer, map, slice or
+// func.
+func isNilVar(v Var) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func NewDeltaInt(name string) *DeltaInt {
+	return Default.NewDeltaInt(name)
+}
+
+func (m *Bucket) NewDeltaInt(name string) *DeltaInt {
+	if v, ok := m.Get(name).(*DeltaInt); ok {
+		return v
 	}
 
-	m.Publish(name, v)
+	v := new(DeltaInt)
+	m.publishNew(name, v)
 	return v
 }
 
@@ -357,15 +1690,115 @@ func Do(f func(KeyValue)) {
 	Default.Do(f)
 }
 
-// Do calls f for each exported variable.
-// The global variable map is locked during the iteration,
-// but existing entries may be concurrently updated.
+// Do calls f for each exported variable, in sorted name order.
+// It iterates over a snapshot of the names, so f does not block Publish and
+// may use the bucket. Vars unpublished during the iteration are skipped,
+// vars published are not visited.
 func (m *Bucket) Do(f func(KeyValue)) {
-	m.varKeysMu.RLock()
-	defer m.varKeysMu.RUnlock()
-	for _, k := range m.varKeys {
+	for _, k := range m.Names() {
 		val, _ := m.vars.Load(k)
-		f(KeyValue{k, val.(Var)})
+		if v, _ := val.(Var); v != nil {
+			f(KeyValue{k, v})
+		}
+	}
+}
+
+// MarshalJSON returns all exported variables as a single JSON object. Vars
+// whose String method does not return valid JSON are left out.
+func (m *Bucket) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	first := true
+	m.doVisible(func(kv KeyValue) {
+		val := kv.Value.String()
+		if !json.Valid([]byte(val)) {
+			return
+		}
+
+		if !first {
+			b.WriteString(",")
+		}
+		first = false
+		fmt.Fprintf(&b, "%s:%s", quoteJSON(kv.Key), val)
+	})
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// Snapshot returns a copy of the current values of all exported variables.
+// Vars of the types in this package are copied using their Value method,
+// Maps are copied recursively, and all other vars are decoded from their
+// String output. Vars that do not produce valid JSON are left out. The
+// returned map does not share any state with m.
+func (m *Bucket) Snapshot() map[string]interface{} {
+	snap := make(map[string]interface{})
+	m.Do(func(kv KeyValue) {
+		if val, ok := snapshotValue(kv.Value); ok {
+			snap[kv.Key] = val
+		}
+	})
+	return snap
+}
+
+// snapshotValue returns a detached copy of the current value of v.
+func snapshotValue(v Var) (interface{}, bool) {
+	switch v := v.(type) {
+	case *Int:
+		return v.Value(), true
+	case *Float:
+		return v.Value(), true
+	case *String:
+		return v.Value(), true
+	case *Bool:
+		return v.Value(), true
+	case *Duration:
+		return v.Value(), true
+	case *Timestamp:
+		return v.Value(), true
+	case *Counter:
+		return v.Value(), true
+	case *Gauge:
+		return v.Value(), true
+	case *Map:
+		snap := make(map[string]interface{})
+		v.Do(func(kv KeyValue) {
+			if val, ok := snapshotValue(kv.Value); ok {
+				snap[kv.Key] = val
+			}
+		})
+		return snap, true
+	}
+
+	var val interface{}
+	if err := json.Unmarshal([]byte(v.String()), &val); err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+// Walk calls f for each exported variable, with its name as path. For each
+// Map it then descends into its entries, calling f with the key appended to
+// the path of the Map using a dot, recursively for nested Maps. No locks
+// are held while f runs, so f may use the bucket and its vars. Vars added
+// during the walk may or may not be visited.
+func (m *Bucket) Walk(f func(path string, v Var)) {
+	for _, name := range m.Names() {
+		if v := m.Get(name); v != nil {
+			walk(name, v, f)
+		}
+	}
+}
+
+func walk(path string, v Var, f func(path string, v Var)) {
+	f(path, v)
+	mv, ok := v.(*Map)
+	if !ok {
+		return
+	}
+	for _, key := range mv.Keys() {
+		if child := mv.Get(key); child != nil {
+			walk(path+"."+key, child, f)
+		}
 	}
 }
 
@@ -377,30 +1810,165 @@ func (f Func) Value() interface{} {
 	return f()
 }
 
+// call calls f. If f panics, the panic is recovered and an object holding
+// it, like {"panic": "..."}, is returned instead, so a single broken Func
+// cannot take down a whole request.
+func (f Func) call() (v interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = map[string]string{"panic": fmt.Sprint(r)}
+		}
+	}()
+	return f()
+}
+
+// String implements the Var interface. If the value cannot be marshaled,
+// it returns an object holding the error, like {"error": "..."}, so the
+// result is always valid JSON.
 func (f Func) String() string {
-	v, _ := json.Marshal(f())
+	v, err := json.Marshal(f.call())
+	if err != nil {
+		v, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
 	return string(v)
 }
 
-func expvarHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	fmt.Fprintf(w, "{\n")
-	first := true
-	Do(func(kv KeyValue) {
-		if !first {
-			fmt.Fprintf(w, ",\n")
+func (f Func) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.call())
+}
+
+// EncodedFunc is a Func whose value is encoded with a custom encoder
+// instead of json.Marshal, and satisfies the Var interface. Output of the
+// encoder that is not valid JSON is rendered as an error.
+type EncodedFunc struct {
+	f   Func
+	enc func(interface{}) ([]byte, error)
+}
+
+func (v *EncodedFunc) Value() interface{} {
+	return v.f()
+}
+
+// String implements the Var interface. Like for Func, a panic or an
+// encoding error is rendered as an object holding it.
+func (v *EncodedFunc) String() string {
+	b, err := v.enc(v.f.call())
+	if err == nil && !json.Valid(b) {
+		err = fmt.Errorf("invalid JSON from encoder: %q", b)
+	}
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return string(b)
+}
+
+func (v *EncodedFunc) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// VarFunc implements Var by calling the function and rendering the Var it
+// returns, so a computed value can be a structured Var such as a Map
+// without being encoded twice. A nil result is rendered as null.
+type VarFunc func() Var
+
+func (f VarFunc) Value() Var {
+	return f()
+}
+
+// String implements the Var interface. Like for Func, a panic is recovered
+// and rendered as an object holding it.
+func (f VarFunc) String() (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			b, _ := json.Marshal(map[string]string{"panic": fmt.Sprint(r)})
+			s = string(b)
 		}
-		first = false
-		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
-	})
-	fmt.Fprintf(w, "\n}\n")
+	}()
+	if v := f(); !isNilVar(v) {
+		return v.String()
+	}
+	return "null"
 }
 
-// Handler returns the expvar HTTP Handler.
-//
-// This is only needed to install the handler in a non-standard location.
-func Handler() http.Handler {
-	return http.HandlerFunc(expvarHandler)
+func (f VarFunc) MarshalJSON() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// TimeoutFunc returns a Func that calls f, but gives up after d and returns
+// the last value f returned instead, or the string "<timeout>" if f has not
+// returned yet. This keeps a slow Func from stalling the whole handler. The
+// call to f is left to finish in the background, and at most one call is in
+// flight at a time: calls made while f is still running wait for that call
+// rather than starting another.
+func TimeoutFunc(f Func, d time.Duration) Func {
+	var (
+		mu       sync.Mutex
+		inflight chan struct{} // closed when the running call returns
+		last     interface{}
+		hasLast  bool
+	)
+	return func() interface{} {
+		mu.Lock()
+		done := inflight
+		if done == nil {
+			done = make(chan struct{})
+			inflight = done
+			go func() {
+				// The handler cannot recover a panic in this goroutine.
+				v := f.call()
+				mu.Lock()
+				last, hasLast = v, true
+				inflight = nil
+				mu.Unlock()
+				close(done)
+			}()
+		}
+		mu.Unlock()
+
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-done:
+		case <-t.C:
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !hasLast {
+			return "<timeout>"
+		}
+		return last
+	}
+}
+
+// defaultsHidden is set to 1 by HideDefaults.
+var defaultsHidden int32
+
+// HideDefaults excludes the cmdline and memstats variables from everything
+// that serializes Default: the handlers, MarshalJSON and the exporters.
+// They stay published in Default, so they are still available through Get,
+// Do, Walk and Snapshot.
+func HideDefaults() {
+	atomic.StoreInt32(&defaultsHidden, 1)
+}
+
+// isHidden reports whether the variable name of m is excluded from the
+// serialized forms of m.
+func isHidden(m *Bucket, name string) bool {
+	if m != Default || atomic.LoadInt32(&defaultsHidden) == 0 {
+		return false
+	}
+	return name == "cmdline" || name == "memstats"
+}
+
+// doVisible calls f like Do, but skips the variables hidden by
+// HideDefaults. It is used wherever the variables of m are serialized.
+func (m *Bucket) doVisible(f func(KeyValue)) {
+	m.Do(func(kv KeyValue) {
+		if !isHidden(m, kv.Key) {
+			f(kv)
+		}
+	})
 }
 
 func cmdline() interface{} {
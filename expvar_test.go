@@ -0,0 +1,1650 @@
+package expvar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestBool(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewBool("enabled")
+	if v.Value() {
+		t.Errorf("v.Value() = true, want false")
+	}
+	if s := v.String(); s != "false" {
+		t.Errorf("v.String() = %q, want %q", s, "false")
+	}
+
+	v.Set(true)
+	if s := v.String(); s != "true" {
+		t.Errorf("v.String() = %q, want %q", s, "true")
+	}
+	if j, err := v.MarshalJSON(); err != nil || string(j) != "true" {
+		t.Errorf("v.MarshalJSON() = %q, %v, want %q", j, err, "true")
+	}
+
+	v.Toggle()
+	if v.Value() {
+		t.Errorf("v.Value() after Toggle = true, want false")
+	}
+}
+
+func TestBoolToggleConcurrent(t *testing.T) {
+	v := new(Bool)
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.Toggle()
+		}()
+	}
+	wg.Wait()
+
+	// An even number of toggles leaves the value unchanged.
+	if v.Value() {
+		t.Errorf("v.Value() after %d toggles = true, want false", n)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewDuration("uptime")
+	v.Set(time.Second)
+	v.Add(500 * time.Millisecond)
+	if d := v.Value(); d != 1500*time.Millisecond {
+		t.Errorf("v.Value() = %v, want 1.5s", d)
+	}
+	if s := v.String(); s != `"1.5s"` {
+		t.Errorf("v.String() = %s, want %s", s, `"1.5s"`)
+	}
+	if j, err := json.Marshal(v); err != nil || string(j) != `"1.5s"` {
+		t.Errorf("json.Marshal(v) = %s, %v, want %s", j, err, `"1.5s"`)
+	}
+
+	v.Set(0)
+	if s := v.String(); s != `"0s"` {
+		t.Errorf("v.String() after Set(0) = %s, want %s", s, `"0s"`)
+	}
+}
+
+func TestMapLenConcurrent(t *testing.T) {
+	const keys = 20
+	m := new(Map)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa(j % keys)
+				m.Add(key, 1)
+				if n := m.Len(); n < 0 || n > keys {
+					t.Errorf("m.Len() = %d, want between 0 and %d", n, keys)
+				}
+				m.Delete(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := m.Len(); n != 0 {
+		t.Errorf("m.Len() after deleting all keys = %d, want 0", n)
+	}
+}
+
+func TestMapKeys(t *testing.T) {
+	m := new(Map)
+	for _, k := range []string{"c", "a", "b"} {
+		m.Add(k, 1)
+	}
+
+	keys := m.Keys()
+	want := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("m.Keys() = %v, want %v", keys, want)
+	}
+
+	m.Add("0", 1)
+	m.Delete("b")
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys after Add and Delete = %v, want %v", keys, want)
+	}
+	if got, want := m.Keys(), []string{"0", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("m.Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestUnpublish(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a")
+	b.NewInt("b")
+
+	b.Unpublish("a")
+	if v := b.Get("a"); v != nil {
+		t.Errorf("b.Get(%q) after Unpublish = %v, want nil", "a", v)
+	}
+	var names []string
+	b.Do(func(kv KeyValue) { names = append(names, kv.Key) })
+	if want := []string{"b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names after Unpublish = %v, want %v", names, want)
+	}
+
+	// Unknown names are ignored.
+	b.Unpublish("missing")
+
+	// The name can be published again.
+	b.NewInt("a").Set(2)
+	if got := b.Get("a").String(); got != "2" {
+		t.Errorf("b.Get(%q) = %s, want 2", "a", got)
+	}
+}
+
+func TestIntMaxMinConcurrent(t *testing.T) {
+	v := new(Int)
+
+	const goroutines, perGoroutine = 50, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				n := int64(i*perGoroutine + j)
+				v.Max(n)
+				v.Max(-n)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got, want := v.Value(), int64(goroutines*perGoroutine-1); got != want {
+		t.Errorf("v.Value() after Max = %d, want %d", got, want)
+	}
+
+	v.Min(10)
+	v.Min(20)
+	if got := v.Value(); got != 10 {
+		t.Errorf("v.Value() after Min = %d, want 10", got)
+	}
+}
+
+func TestIntSwapConcurrentAdd(t *testing.T) {
+	v := new(Int)
+
+	const adders, adds = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < adders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				v.Add(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var swapped int64
+	go func() {
+		defer close(done)
+		for i := 0; i < adds; i++ {
+			swapped += v.Swap(0)
+		}
+	}()
+
+	wg.Wait()
+	<-done
+
+	if got, want := swapped+v.Value(), int64(adders*adds); got != want {
+		t.Errorf("swapped + remaining = %d, want %d", got, want)
+	}
+}
+
+func TestIntCompareAndSwap(t *testing.T) {
+	v := new(Int)
+	v.Set(1)
+	if v.CompareAndSwap(2, 3) {
+		t.Errorf("v.CompareAndSwap(2, 3) = true, want false")
+	}
+	if !v.CompareAndSwap(1, 3) {
+		t.Errorf("v.CompareAndSwap(1, 3) = false, want true")
+	}
+	if got := v.Value(); got != 3 {
+		t.Errorf("v.Value() = %d, want 3", got)
+	}
+}
+
+// rawVar is a Var rendering as its own text, valid JSON or not.
+type rawVar string
+
+func (v rawVar) String() string { return string(v) }
+
+func TestBucketMarshalJSON(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("int").Set(3)
+	b.NewFloat("float").Set(1.5)
+	b.NewString("string").Set("x")
+	b.NewMap("map").Add("a", 1)
+	b.Publish("invalid", rawVar("{"))
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("json.Marshal(b) failed: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed: %v", data, err)
+	}
+
+	want := map[string]interface{}{
+		"int":    3.0,
+		"float":  1.5,
+		"string": "x",
+		"map":    map[string]interface{}{"a": 1.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Marshal(b) = %s, want %v", data, want)
+	}
+}
+
+func TestMapClearConcurrentAdd(t *testing.T) {
+	m := new(Map)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				m.Add(strconv.Itoa(j%26), 1)
+				if j%7 == 0 {
+					m.Clear()
+				}
+				if s := m.String(); !json.Valid([]byte(s)) {
+					t.Errorf("m.String() = %q, not valid JSON", s)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	m.Clear()
+	if n := m.Len(); n != 0 {
+		t.Errorf("m.Len() after Clear = %d, want 0", n)
+	}
+	if s := m.String(); s != "{}" {
+		t.Errorf("m.String() after Clear = %q, want {}", s)
+	}
+
+	// The map is still usable after Clear.
+	m.Add("a", 1)
+	if got := m.String(); got != `{"a": 1}` {
+		t.Errorf("m.String() = %q, want %q", got, `{"a": 1}`)
+	}
+}
+
+func TestCounterLargeValues(t *testing.T) {
+	v := new(Counter)
+	v.Add(math.MaxUint64 - 1)
+	v.Inc()
+	if got := v.Value(); got != math.MaxUint64 {
+		t.Errorf("v.Value() = %d, want %d", got, uint64(math.MaxUint64))
+	}
+	if got, want := v.String(), "18446744073709551615"; got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+	if j, err := json.Marshal(v); err != nil || string(j) != "18446744073709551615" {
+		t.Errorf("json.Marshal(v) = %s, %v, want 18446744073709551615", j, err)
+	}
+
+	if got := v.Reset(); got != math.MaxUint64 {
+		t.Errorf("v.Reset() = %d, want %d", got, uint64(math.MaxUint64))
+	}
+	if got := v.Value(); got != 0 {
+		t.Errorf("v.Value() after Reset = %d, want 0", got)
+	}
+}
+
+func TestCounterResetConcurrent(t *testing.T) {
+	v := new(Counter)
+
+	const adders, adds = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < adders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				v.Inc()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var reset uint64
+	go func() {
+		defer close(done)
+		for i := 0; i < adds; i++ {
+			reset += v.Reset()
+		}
+	}()
+
+	wg.Wait()
+	<-done
+
+	if got, want := reset+v.Value(), uint64(adders*adds); got != want {
+		t.Errorf("reset + remaining = %d, want %d", got, want)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewGauge("temperature")
+	v.Set(-1.5)
+	v.Inc()
+	if got := v.Value(); got != -0.5 {
+		t.Errorf("v.Value() = %v, want -0.5", got)
+	}
+	v.Dec()
+	v.Add(0.25)
+	if got := v.String(); got != "-1.25" {
+		t.Errorf("v.String() = %s, want -1.25", got)
+	}
+	if j, err := json.Marshal(v); err != nil || string(j) != "-1.25" {
+		t.Errorf("json.Marshal(v) = %s, %v, want -1.25", j, err)
+	}
+}
+
+func TestFloatNaNAndInf(t *testing.T) {
+	b := new(Bucket)
+	m := b.NewMap("map")
+	for i, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		v := b.NewFloat("float" + strconv.Itoa(i))
+		v.Set(f)
+		if got := v.String(); got != "null" {
+			t.Errorf("Float(%v).String() = %s, want null", f, got)
+		}
+		m.AddFloat("key"+strconv.Itoa(i), f)
+	}
+
+	if s := m.String(); !json.Valid([]byte(s)) {
+		t.Errorf("m.String() = %s, not valid JSON", s)
+	}
+	data, err := json.Marshal(b)
+	if err != nil || !json.Valid(data) {
+		t.Errorf("json.Marshal(b) = %s, %v, want valid JSON", data, err)
+	}
+	if w := serve(HandlerFor(b), "/"); !json.Valid(w.Body.Bytes()) {
+		t.Errorf("handler output = %s, not valid JSON", w.Body.Bytes())
+	}
+}
+
+func TestMapTypedGetters(t *testing.T) {
+	m := new(Map)
+	m.Add("int", 1)
+	m.AddFloat("float", 1.5)
+	s := new(String)
+	s.Set("x")
+	m.Set("string", s)
+
+	if v, ok := m.GetInt("int"); !ok || v.Value() != 1 {
+		t.Errorf("m.GetInt(%q) = %v, %v, want 1, true", "int", v, ok)
+	}
+	if v, ok := m.GetFloat("float"); !ok || v.Value() != 1.5 {
+		t.Errorf("m.GetFloat(%q) = %v, %v, want 1.5, true", "float", v, ok)
+	}
+	if v, ok := m.GetString("string"); !ok || v.Value() != "x" {
+		t.Errorf("m.GetString(%q) = %v, %v, want x, true", "string", v, ok)
+	}
+
+	// Present, but of the wrong type.
+	if v, ok := m.GetInt("float"); ok || v != nil {
+		t.Errorf("m.GetInt(%q) = %v, %v, want nil, false", "float", v, ok)
+	}
+	if v, ok := m.GetFloat("string"); ok || v != nil {
+		t.Errorf("m.GetFloat(%q) = %v, %v, want nil, false", "string", v, ok)
+	}
+	if v, ok := m.GetString("int"); ok || v != nil {
+		t.Errorf("m.GetString(%q) = %v, %v, want nil, false", "int", v, ok)
+	}
+
+	// Absent.
+	if v, ok := m.GetInt("missing"); ok || v != nil {
+		t.Errorf("m.GetInt(%q) = %v, %v, want nil, false", "missing", v, ok)
+	}
+	if v, ok := m.GetFloat("missing"); ok || v != nil {
+		t.Errorf("m.GetFloat(%q) = %v, %v, want nil, false", "missing", v, ok)
+	}
+	if v, ok := m.GetString("missing"); ok || v != nil {
+		t.Errorf("m.GetString(%q) = %v, %v, want nil, false", "missing", v, ok)
+	}
+}
+
+func TestBucketSnapshot(t *testing.T) {
+	b := new(Bucket)
+	i := b.NewInt("int")
+	i.Set(1)
+	s := b.NewString("string")
+	s.Set("x")
+	m := b.NewMap("map")
+	m.Add("a", 2)
+	b.Publish("func", Func(func() interface{} { return []int{1} }))
+
+	snap := b.Snapshot()
+	want := map[string]interface{}{
+		"int":    int64(1),
+		"string": "x",
+		"map":    map[string]interface{}{"a": int64(2)},
+		"func":   []interface{}{1.0},
+	}
+	if !reflect.DeepEqual(snap, want) {
+		t.Fatalf("b.Snapshot() = %v, want %v", snap, want)
+	}
+
+	i.Set(5)
+	s.Set("y")
+	m.Add("a", 1)
+	m.Add("b", 1)
+	if !reflect.DeepEqual(snap, want) {
+		t.Errorf("snapshot after updates = %v, want %v", snap, want)
+	}
+}
+
+func TestTryPublish(t *testing.T) {
+	b := new(Bucket)
+	v := new(Int)
+	v.Set(1)
+	if err := b.TryPublish("requests", v); err != nil {
+		t.Fatalf("b.TryPublish() = %v, want nil", err)
+	}
+
+	if err := b.TryPublish("requests", new(Int)); err != ErrDuplicateKey {
+		t.Errorf("b.TryPublish() of a duplicate = %v, want ErrDuplicateKey", err)
+	}
+	if got := b.Get("requests"); got != v {
+		t.Errorf("b.Get(%q) = %v, want the original var", "requests", got)
+	}
+
+	if err := b.TryPublish("nil", nil); err != ErrNilVar {
+		t.Errorf("b.TryPublish() of nil = %v, want ErrNilVar", err)
+	}
+}
+
+func TestBucketMerge(t *testing.T) {
+	a := new(Bucket)
+	a.NewInt("requests").Set(1)
+	other := new(Bucket)
+	shared := other.NewInt("requests")
+	shared.Set(2)
+	other.NewInt("errors").Set(3)
+
+	a.Merge(other, "other.")
+	if got, want := a.Names(), []string{"other.errors", "other.requests", "requests"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("a.Names() = %v, want %v", got, want)
+	}
+	if got := a.Get("requests").String(); got != "1" {
+		t.Errorf("a.Get(%q) = %s, want 1", "requests", got)
+	}
+	if got := a.Get("other.requests").String(); got != "2" {
+		t.Errorf("a.Get(%q) = %s, want 2", "other.requests", got)
+	}
+
+	// The vars are shared, not copied.
+	shared.Add(1)
+	if got := a.Get("other.requests").String(); got != "3" {
+		t.Errorf("a.Get(%q) after update = %s, want 3", "other.requests", got)
+	}
+
+	// Names that already exist are skipped.
+	a.Merge(other, "other.")
+	if got := len(a.Names()); got != 3 {
+		t.Errorf("len(a.Names()) after second Merge = %d, want 3", got)
+	}
+}
+
+func TestMapOnNewKeyConcurrent(t *testing.T) {
+	const keys = 26
+	m := new(Map)
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	m.OnNewKey(func(key string) {
+		// The hook runs without locks held, so it may use the map.
+		m.Len()
+		mu.Lock()
+		calls[key]++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Add(strconv.Itoa(j%keys), 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(calls) != keys {
+		t.Errorf("hook called for %d keys, want %d", len(calls), keys)
+	}
+	for key, n := range calls {
+		if n != 1 {
+			t.Errorf("hook called %d times for %q, want 1", n, key)
+		}
+	}
+}
+
+func TestBucketNames(t *testing.T) {
+	b := new(Bucket)
+	for _, name := range []string{"c", "a", "b"} {
+		b.NewInt(name)
+	}
+
+	names := b.Names()
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("b.Names() = %v, want %v", names, want)
+	}
+
+	names[0] = "z"
+	_ = append(names[:1], "y")
+	if got, want := b.Names(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("b.Names() after modifying the result = %v, want %v", got, want)
+	}
+}
+
+func TestTimestampSetNow(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewTimestamp("started")
+
+	before := time.Now()
+	v.SetNow()
+	after := time.Now()
+
+	var s string
+	if err := json.Unmarshal([]byte(v.String()), &s); err != nil {
+		t.Fatalf("v.String() = %s, not a JSON string: %v", v.String(), err)
+	}
+	got, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatalf("time.Parse(%q) failed: %v", s, err)
+	}
+	if got.Before(before) || got.After(after) {
+		t.Errorf("parsed time %v not between %v and %v", got, before, after)
+	}
+}
+
+func TestTimestampSet(t *testing.T) {
+	v := new(Timestamp)
+	if got := v.Value(); !got.IsZero() {
+		t.Errorf("v.Value() of an unset Timestamp = %v, want the zero time", got)
+	}
+
+	tests := []struct {
+		set, want time.Time
+	}{
+		{time.Unix(0, 0), time.Unix(0, 0)},
+		{time.Unix(-1, 0), time.Unix(-1, 0)},
+		{time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)},
+		{time.Time{}, time.Time{}},
+		{time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC), time.Unix(0, math.MinInt64+1)},
+		{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), time.Unix(0, math.MaxInt64)},
+	}
+	for _, tt := range tests {
+		v.Set(tt.set)
+		if got := v.Value(); !got.Equal(tt.want) || got.IsZero() != tt.want.IsZero() {
+			t.Errorf("after v.Set(%v): v.Value() = %v, want %v", tt.set, got, tt.want)
+		}
+	}
+}
+
+func TestMapDeleteFunc(t *testing.T) {
+	m := new(Map)
+	for i := 9; i >= 0; i-- {
+		m.Add(strconv.Itoa(i), int64(i))
+	}
+
+	m.DeleteFunc(func(kv KeyValue) bool {
+		return kv.Value.(*Int).Value()%2 == 1
+	})
+
+	if got, want := m.Keys(), []string{"0", "2", "4", "6", "8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("m.Keys() = %v, want %v", got, want)
+	}
+	for _, key := range []string{"1", "3", "5", "7", "9"} {
+		if v := m.Get(key); v != nil {
+			t.Errorf("m.Get(%q) = %v, want nil", key, v)
+		}
+	}
+	if got, want := m.String(), `{"0": 0, "2": 2, "4": 4, "6": 6, "8": 8}`; got != want {
+		t.Errorf("m.String() = %s, want %s", got, want)
+	}
+}
+
+func TestFloatMaxMinConcurrent(t *testing.T) {
+	v := new(Float)
+	v.Set(math.Inf(-1))
+
+	const goroutines, perGoroutine = 50, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				f := float64(i*perGoroutine+j) / 4
+				v.Max(f)
+				v.Max(-f)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got, want := v.Value(), float64(goroutines*perGoroutine-1)/4; got != want {
+		t.Errorf("v.Value() after Max = %v, want %v", got, want)
+	}
+
+	v.Min(-2.5)
+	v.Min(1)
+	if got := v.Value(); got != -2.5 {
+		t.Errorf("v.Value() after Min = %v, want -2.5", got)
+	}
+}
+
+func TestMapDoOrdered(t *testing.T) {
+	m := new(Map)
+	for _, k := range []string{"c", "a", "b"} {
+		m.Add(k, 1)
+	}
+	m.Add("c", 1) // Updating a key keeps its position.
+
+	keys := func(order SortOrder) []string {
+		var keys []string
+		m.DoOrdered(order, func(kv KeyValue) {
+			keys = append(keys, kv.Key)
+		})
+		return keys
+	}
+	if got, want := keys(Sorted), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DoOrdered(Sorted) visited %v, want %v", got, want)
+	}
+	if got, want := keys(Insertion), []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DoOrdered(Insertion) visited %v, want %v", got, want)
+	}
+
+	m.Delete("a")
+	m.Add("a", 1)
+	if got, want := keys(Insertion), []string{"c", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DoOrdered(Insertion) after re-adding visited %v, want %v", got, want)
+	}
+}
+
+// panicMessage returns the value f panics with, formatted as a string, or
+// "" if it does not panic.
+func panicMessage(f func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprint(r)
+		}
+	}()
+	f()
+	return ""
+}
+
+func TestPublishNil(t *testing.T) {
+	b := new(Bucket)
+	for _, v := range []Var{nil, (*Int)(nil), Func(nil)} {
+		msg := panicMessage(func() { b.Publish("broken", v) })
+		if !strings.Contains(msg, "nil var") || !strings.Contains(msg, "broken") {
+			t.Errorf("Publish(%q, %#v) panicked with %q, want a message naming the nil var", "broken", v, msg)
+		}
+	}
+	if v := b.Get("broken"); v != nil {
+		t.Errorf("b.Get(%q) = %v, want nil", "broken", v)
+	}
+}
+
+func TestMapSetNil(t *testing.T) {
+	m := new(Map)
+	msg := panicMessage(func() { m.Set("broken", nil) })
+	if !strings.Contains(msg, "nil var") || !strings.Contains(msg, "broken") {
+		t.Errorf("m.Set(%q, nil) panicked with %q, want a message naming the nil var", "broken", msg)
+	}
+	if n := m.Len(); n != 0 {
+		t.Errorf("m.Len() = %d, want 0", n)
+	}
+}
+
+func TestMapAddInt(t *testing.T) {
+	m := new(Map)
+	if got := m.AddInt("requests", 2); got != 2 {
+		t.Errorf("m.AddInt() of a new key = %d, want 2", got)
+	}
+	if got := m.AddInt("requests", 3); got != 5 {
+		t.Errorf("m.AddInt() = %d, want 5", got)
+	}
+	if iv, ok := m.GetInt("requests"); !ok || iv.Value() != 5 {
+		t.Errorf("m.GetInt() = %v, %v, want 5, true", iv, ok)
+	}
+
+	const goroutines, adds = 8, 100
+	results := make(chan int64, goroutines*adds)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				results <- m.AddInt("concurrent", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	// Every increment returns a distinct running total.
+	seen := make(map[int64]bool)
+	for n := range results {
+		if seen[n] {
+			t.Errorf("m.AddInt() returned %d twice", n)
+		}
+		seen[n] = true
+	}
+	if iv, _ := m.GetInt("concurrent"); iv.Value() != goroutines*adds {
+		t.Errorf("final value = %d, want %d", iv.Value(), goroutines*adds)
+	}
+}
+
+func TestBucketReset(t *testing.T) {
+	b := new(Bucket)
+	i := b.NewInt("int")
+	f := b.NewFloat("float")
+	c := b.NewCounter("counter")
+	m := b.NewMap("map")
+	s := b.NewString("string")
+	i.Add(3)
+	f.Add(1.5)
+	c.Inc()
+	m.Add("a", 2)
+	s.Set("x")
+
+	b.Reset()
+
+	if got, want := b.Names(), []string{"counter", "float", "int", "map", "string"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("b.Names() after Reset = %v, want %v", got, want)
+	}
+	for _, name := range []string{"int", "float", "counter"} {
+		if got := b.Get(name).String(); got != "0" {
+			t.Errorf("%s after Reset = %s, want 0", name, got)
+		}
+	}
+	if got := m.String(); got != `{"a": 0}` {
+		t.Errorf("map after Reset = %s, want %s", got, `{"a": 0}`)
+	}
+	// Vars that cannot be reset are left alone.
+	if got := s.Value(); got != "x" {
+		t.Errorf("string after Reset = %q, want %q", got, "x")
+	}
+}
+
+func TestFuncMarshalError(t *testing.T) {
+	f := Func(func() interface{} { return make(chan int) })
+
+	const want = `{"error":"json: unsupported type: chan int"}`
+	if got := f.String(); got != want {
+		t.Errorf("f.String() = %s, want %s", got, want)
+	}
+
+	b := new(Bucket)
+	b.Publish("func", f)
+	b.NewInt("int").Set(1)
+	w := serve(HandlerFor(b), "/")
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.Bytes(), err)
+	}
+	if got, ok := doc["func"].(map[string]interface{}); !ok || got["error"] == nil {
+		t.Errorf("func = %v, want an error object", doc["func"])
+	}
+}
+
+func TestMapDoWhile(t *testing.T) {
+	m := new(Map)
+	for _, k := range []string{"d", "b", "a", "c"} {
+		m.Add(k, 1)
+	}
+
+	var visited []string
+	m.DoWhile(func(kv KeyValue) bool {
+		visited = append(visited, kv.Key)
+		// The map may be used from within f.
+		m.Add("e", 1)
+		return kv.Key != "b"
+	})
+	if want := []string{"a", "b"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("DoWhile visited %v, want %v", visited, want)
+	}
+
+	// No lock is left held after an early return.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Delete("a")
+		m.Add("f", 1)
+		m.Clear()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("map still locked after DoWhile returned")
+	}
+}
+
+func TestMapClone(t *testing.T) {
+	m := new(Map)
+	m.Add("int", 1)
+	m.AddFloat("float", 1.5)
+	nested := new(Map)
+	nested.Add("a", 1)
+	m.Set("map", nested)
+
+	ring := newRingBuffer(2)
+	ring.Add(1)
+	m.Set("ring", ring)
+	hist := newHistogram([]float64{1})
+	hist.Observe(0.5)
+	m.Set("histogram", hist)
+	set := new(StringSet)
+	set.Add("a")
+	m.Set("set", set)
+	ewma := newEWMA(0.5)
+	ewma.Update(1)
+	m.Set("ewma", ewma)
+	vec := newCounterVec([]string{"method", "code"})
+	vec.WithLabelValues("GET", "200").Inc()
+	m.Set("countervec", vec)
+	sharded := new(ShardedInt)
+	sharded.Add(1)
+	m.Set("sharded", sharded)
+	sample := newSample(10)
+	sample.Update(1)
+	m.Set("sample", sample)
+	flags := newFlags([]string{"a", "b"})
+	flags.Set("a", true)
+	m.Set("flags", flags)
+	health := new(Health)
+	health.SetStatus("db", "healthy")
+	m.Set("health", health)
+	series := newTimeSeries(2)
+	recordAt(series, time.Unix(1, 0), 1)
+	m.Set("timeseries", series)
+	group := newGroup([]string{"a"})
+	group.Update(func(ints map[string]*Int) { ints["a"].Add(1) })
+	m.Set("group", group)
+	rng := newRange()
+	rng.Observe(1)
+	m.Set("range", rng)
+
+	want := m.String()
+	c := m.Clone()
+	if got := c.String(); got != want {
+		t.Fatalf("c.String() = %s, want %s", got, want)
+	}
+
+	m.Add("int", 1)
+	m.AddFloat("float", 1)
+	nested.Add("a", 1)
+	ring.Add(2)
+	hist.Observe(2)
+	set.Add("b")
+	ewma.Update(3)
+	vec.WithLabelValues("GET", "200").Inc()
+	vec.WithLabelValues("GET", "404").Inc()
+	sharded.Add(1)
+	sample.Update(2)
+	flags.Set("b", true)
+	health.SetStatus("db", "down")
+	recordAt(series, time.Unix(2, 0), 2)
+	group.Update(func(ints map[string]*Int) { ints["a"].Add(1) })
+	rng.Observe(2)
+	m.Add("new", 1)
+
+	if got := c.String(); got != want {
+		t.Errorf("c.String() after updating the original = %s, want %s", got, want)
+	}
+
+	// The clone is independent in the other direction too.
+	c.Add("int", 10)
+	if iv, _ := m.GetInt("int"); iv.Value() != 2 {
+		t.Errorf("original int after updating the clone = %d, want 2", iv.Value())
+	}
+}
+
+func TestBucketWalk(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests")
+	m := b.NewMap("http")
+	codes := new(Map)
+	codes.Add("200", 1)
+	codes.Add("404", 1)
+	m.Set("codes", codes)
+	m.Add("errors", 1)
+
+	var paths []string
+	b.Walk(func(path string, v Var) {
+		paths = append(paths, path)
+	})
+	want := []string{"http", "http.codes", "http.codes.200", "http.codes.404", "http.errors", "requests"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Walk visited %v, want %v", paths, want)
+	}
+}
+
+func TestStringAppendConcurrent(t *testing.T) {
+	v := new(String)
+
+	const goroutines, perGoroutine = 50, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				v.Append("ab")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := len(v.Value()), goroutines*perGoroutine*2; got != want {
+		t.Errorf("len(v.Value()) = %d, want %d", got, want)
+	}
+
+	b := &String{max: 5}
+	b.Set("abc")
+	want := "abcde" + truncatedSuffix
+	if got := b.Append("def"); got != want {
+		t.Errorf("b.Append(%q) = %q, want %q", "def", got, want)
+	}
+	if got := b.Value(); got != want {
+		t.Errorf("b.Value() = %q, want %q", got, want)
+	}
+}
+
+func TestNewFloatTwice(t *testing.T) {
+	b := new(Bucket)
+	f := b.NewFloat("ratio")
+	f.Set(0.5)
+	if got := b.NewFloat("ratio"); got != f {
+		t.Errorf("second NewFloat returned %p, want %p", got, f)
+	}
+	if got := f.Value(); got != 0.5 {
+		t.Errorf("f.Value() = %v, want 0.5", got)
+	}
+}
+
+func TestNewFunc(t *testing.T) {
+	b := new(Bucket)
+	b.NewFunc("answer", func() interface{} { return 42 })
+	// A second call returns the published Func rather than panicking.
+	b.NewFunc("answer", func() interface{} { return 0 })
+
+	v, ok := b.Get("answer").(Func)
+	if !ok {
+		t.Fatalf("Get(%q) = %T, want Func", "answer", b.Get("answer"))
+	}
+	if got := v.String(); got != "42" {
+		t.Errorf("v.String() = %q, want %q", got, "42")
+	}
+}
+
+func TestMapLoadOrStoreConcurrent(t *testing.T) {
+	m := new(Map)
+
+	const goroutines = 50
+	var stored int32
+	actuals := make([]Var, goroutines)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			actual, loaded := m.LoadOrStore("key", new(Int))
+			if !loaded {
+				atomic.AddInt32(&stored, 1)
+			}
+			actuals[i] = actual
+		}(i)
+	}
+	wg.Wait()
+
+	if stored != 1 {
+		t.Errorf("%d LoadOrStore calls stored, want 1", stored)
+	}
+	for i, v := range actuals {
+		if v != m.Get("key") {
+			t.Errorf("goroutine %d got %p, want the stored %p", i, v, m.Get("key"))
+		}
+	}
+	if got, want := m.Keys(), []string{"key"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("m.Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestBoundedString(t *testing.T) {
+	b := new(Bucket)
+	s := b.NewBoundedString("log", 8)
+
+	// The limit falls inside the two-byte ö, which must not be split.
+	s.Set("hello wörld")
+	want := "hello w" + truncatedSuffix
+	if got := s.Value(); got != want {
+		t.Errorf("s.Value() = %q, want %q", got, want)
+	}
+	if !utf8.ValidString(s.Value()) {
+		t.Errorf("s.Value() = %q is not valid UTF-8", s.Value())
+	}
+	var decoded string
+	if err := json.Unmarshal([]byte(s.String()), &decoded); err != nil || decoded != want {
+		t.Errorf("s.String() = %s, want the JSON string %q", s.String(), want)
+	}
+
+	s.Set("abc")
+	if got := s.Value(); got != "abc" {
+		t.Errorf("s.Value() = %q, want %q", got, "abc")
+	}
+}
+
+func TestIntAddChecked(t *testing.T) {
+	v := new(Int)
+	v.Set(math.MaxInt64 - 1)
+	if n, ok := v.AddChecked(1); !ok || n != math.MaxInt64 {
+		t.Errorf("v.AddChecked(1) = %d, %v, want %d, true", n, ok, int64(math.MaxInt64))
+	}
+	if n, ok := v.AddChecked(1); ok || n != math.MaxInt64 {
+		t.Errorf("v.AddChecked(1) at max = %d, %v, want %d, false", n, ok, int64(math.MaxInt64))
+	}
+	if got := v.Value(); got != math.MaxInt64 {
+		t.Errorf("v.Value() after overflow = %d, want %d", got, int64(math.MaxInt64))
+	}
+
+	v.Set(math.MinInt64)
+	if n, ok := v.AddChecked(-1); ok || n != math.MinInt64 {
+		t.Errorf("v.AddChecked(-1) at min = %d, %v, want %d, false", n, ok, int64(math.MinInt64))
+	}
+	if n, ok := v.AddChecked(math.MaxInt64); !ok || n != -1 {
+		t.Errorf("v.AddChecked(MaxInt64) at min = %d, %v, want -1, true", n, ok)
+	}
+}
+
+func TestMapSumIntAverageFloat(t *testing.T) {
+	m := new(Map)
+	m.Add("a", 3)
+	m.Add("b", 4)
+	m.AddFloat("x", 1.5)
+	m.AddFloat("y", 2.5)
+	s := new(String)
+	s.Set("ignored")
+	m.Set("s", s)
+
+	if got := m.SumInt(); got != 7 {
+		t.Errorf("m.SumInt() = %d, want 7", got)
+	}
+	if got := m.AverageFloat(); got != 2 {
+		t.Errorf("m.AverageFloat() = %v, want 2", got)
+	}
+
+	empty := new(Map)
+	if got := empty.SumInt(); got != 0 {
+		t.Errorf("empty.SumInt() = %d, want 0", got)
+	}
+	if got := empty.AverageFloat(); got != 0 {
+		t.Errorf("empty.AverageFloat() = %v, want 0", got)
+	}
+}
+
+func TestMapDoConcurrentMutation(t *testing.T) {
+	m := new(Map)
+	for i := 0; i < 50; i++ {
+		m.Add(fmt.Sprintf("k%02d", i), 1)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				m.Add(fmt.Sprintf("n%d-%d", g, i), 1)
+				m.Delete(fmt.Sprintf("k%02d", i%50))
+			}
+		}(g)
+	}
+	for i := 0; i < 100; i++ {
+		prev := ""
+		m.Do(func(kv KeyValue) {
+			if kv.Key <= prev {
+				t.Errorf("Do visited %q after %q", kv.Key, prev)
+			}
+			prev = kv.Key
+			if kv.Value == nil {
+				t.Errorf("Do visited %q with a nil value", kv.Key)
+			}
+			// f may use the map without deadlocking.
+			m.Set("x"+kv.Key[:1], new(Int))
+		})
+	}
+	wg.Wait()
+}
+
+// benchmarkMapDo measures iterating a Map of 1000 entries with do while
+// another goroutine keeps adding keys, and reports the adds it made per
+// iteration.
+func benchmarkMapDo(b *testing.B, do func(*Map, func(KeyValue))) {
+	m := new(Map)
+	for i := 0; i < 1000; i++ {
+		m.Add(strconv.Itoa(i), 1)
+	}
+
+	done := make(chan struct{})
+	var adds int64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			m.Add("new"+strconv.Itoa(i%5000), 1)
+			atomic.AddInt64(&adds, 1)
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var sum int64
+		do(m, func(kv KeyValue) {
+			if iv, ok := kv.Value.(*Int); ok {
+				sum += iv.Value()
+			}
+		})
+	}
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+	b.ReportMetric(float64(atomic.LoadInt64(&adds))/float64(b.N), "adds/op")
+}
+
+func BenchmarkMapDoConcurrentAdd(b *testing.B) {
+	benchmarkMapDo(b, (*Map).Do)
+}
+
+// BenchmarkMapDoLockedConcurrentAdd iterates the way Do did before it
+// worked on a snapshot, holding the read lock for the whole iteration.
+func BenchmarkMapDoLockedConcurrentAdd(b *testing.B) {
+	benchmarkMapDo(b, func(m *Map, f func(KeyValue)) {
+		m.keysMu.RLock()
+		defer m.keysMu.RUnlock()
+		for _, k := range m.keys {
+			if i, ok := m.m.Load(k); ok {
+				f(KeyValue{k, i.(Var)})
+			}
+		}
+	})
+}
+
+func TestBucketPublishAll(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a")
+	vars := make(map[string]Var)
+	for i := 0; i < 30; i++ {
+		vars[fmt.Sprintf("v%02d", i)] = new(Int)
+	}
+	if err := b.PublishAll(vars); err != nil {
+		t.Fatalf("PublishAll: %v", err)
+	}
+
+	names := b.Names()
+	if len(names) != 31 {
+		t.Fatalf("len(b.Names()) = %d, want 31", len(names))
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("b.Names() = %v, want sorted", names)
+	}
+
+	err := b.PublishAll(map[string]Var{"b": new(Int), "v03": new(Int)})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("PublishAll with a duplicate = %v, want ErrDuplicateKey", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "v03") {
+		t.Errorf("error %v does not name the duplicate v03", err)
+	}
+	if b.Get("b") != nil || len(b.Names()) != 31 {
+		t.Errorf("failed PublishAll left b with %v", b.Names())
+	}
+}
+
+func TestMapSetBatch(t *testing.T) {
+	m := new(Map)
+	var added []string
+	m.OnNewKey(func(key string) { added = append(added, key) })
+	m.Set("b", new(Int))
+
+	batch := func(n int64) map[string]Var {
+		entries := make(map[string]Var)
+		for _, key := range []string{"a", "b", "c", "d"} {
+			v := new(Int)
+			v.Set(n)
+			entries[key] = v
+		}
+		return entries
+	}
+	m.SetBatch(batch(1))
+	if got, want := m.Keys(), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("m.Keys() = %v, want %v", got, want)
+	}
+	if got, want := added, []string{"b", "a", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OnNewKey saw %v, want %v", got, want)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			m.SetBatch(batch(int64(i)))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		var seen []int64
+		m.Do(func(kv KeyValue) {
+			seen = append(seen, kv.Value.(*Int).Value())
+		})
+		for _, n := range seen {
+			if n != seen[0] {
+				t.Fatalf("Do saw a mix of batches: %v", seen)
+			}
+		}
+	}
+}
+
+func TestVarFunc(t *testing.T) {
+	calls := 0
+	f := VarFunc(func() Var {
+		calls++
+		m := new(Map)
+		m.Add("calls", int64(calls))
+		return m
+	})
+	for _, want := range []string{`{"calls": 1}`, `{"calls": 2}`} {
+		if got := f.String(); got != want {
+			t.Errorf("f.String() = %s, want %s", got, want)
+		}
+	}
+
+	if got := VarFunc(func() Var { return nil }).String(); got != "null" {
+		t.Errorf("nil result: String() = %s, want null", got)
+	}
+
+	broken := VarFunc(func() Var { panic("boom") })
+	if got, want := broken.String(), `{"panic":"boom"}`; got != want {
+		t.Errorf("panicking VarFunc: String() = %s, want %s", got, want)
+	}
+}
+
+func TestMapReplace(t *testing.T) {
+	// build returns a Map of n entries, all holding n.
+	build := func(n int) *Map {
+		src := new(Map)
+		for i := 0; i < n; i++ {
+			src.Add(fmt.Sprintf("k%d", i), int64(n))
+		}
+		return src
+	}
+
+	m := new(Map)
+	m.Replace(build(3))
+	m.Replace(build(2))
+	if got, want := m.String(), `{"k0": 2, "k1": 2}`; got != want {
+		t.Errorf("m.String() = %s, want %s", got, want)
+	}
+	if m.Get("k2") != nil {
+		t.Error("entry k2 survived the Replace")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			m.Replace(build(i%7 + 1))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		var seen []int64
+		m.Do(func(kv KeyValue) {
+			seen = append(seen, kv.Value.(*Int).Value())
+		})
+		// Entries removed by a later Replace may be skipped, but the
+		// values seen must all come from the same one.
+		for _, n := range seen {
+			if n != seen[0] || int64(len(seen)) > n {
+				t.Fatalf("Do saw a mix of contents: %v", seen)
+			}
+		}
+	}
+}
+
+// storeRaw stores val under key in the sync.Map behind m, bypassing the
+// checks of Set, to simulate a corrupt entry.
+func storeRaw(m *Map, key string, val interface{}) {
+	m.m.Store(key, val)
+	m.addKey(key)
+}
+
+func TestMapCorruptEntry(t *testing.T) {
+	m := new(Map)
+	m.Add("a", 1)
+	storeRaw(m, "b", 42)
+	m.Add("c", 2)
+
+	var keys []string
+	m.Do(func(kv KeyValue) { keys = append(keys, kv.Key) })
+	if want := []string{"a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Do visited %v, want %v", keys, want)
+	}
+	if got, want := m.String(), `{"a": 1, "c": 2}`; got != want {
+		t.Errorf("m.String() = %s, want %s", got, want)
+	}
+	if got := m.Get("b"); got != nil {
+		t.Errorf("m.Get(%q) = %v, want nil", "b", got)
+	}
+	if v, loaded := m.LoadOrStore("b", new(Int)); v != nil || !loaded {
+		t.Errorf("m.LoadOrStore(%q) = %v, %v, want nil, true", "b", v, loaded)
+	}
+}
+
+func TestBucketCorruptEntry(t *testing.T) {
+	b := new(Bucket)
+	b.vars.Store("x", 1)
+	b.varKeys = append(b.varKeys, "x")
+	b.NewInt("y")
+
+	var keys []string
+	b.Do(func(kv KeyValue) { keys = append(keys, kv.Key) })
+	if want := []string{"y"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Do visited %v, want %v", keys, want)
+	}
+	if got := b.Get("x"); got != nil {
+		t.Errorf("b.Get(%q) = %v, want nil", "x", got)
+	}
+	if msg, want := panicMessage(func() { b.NewFloat("y") }), `expvar: var "y" has type *expvar.Int, not *expvar.Float`; msg != want {
+		t.Errorf("NewFloat of an Int name panicked with %q, want %q", msg, want)
+	}
+	if msg, want := panicMessage(func() { b.NewInt("x") }), `expvar: var "x" has type int, not *expvar.Int`; msg != want {
+		t.Errorf("NewInt of a corrupt entry panicked with %q, want %q", msg, want)
+	}
+}
+
+func TestLoadOrPublish(t *testing.T) {
+	b := new(Bucket)
+	i := new(Int)
+	if v, err := b.LoadOrPublish("requests", i); err != nil || v != i {
+		t.Fatalf("b.LoadOrPublish() = %v, %v, want the new Int", v, err)
+	}
+	if v, err := b.LoadOrPublish("requests", new(Int)); err != nil || v != i {
+		t.Errorf("b.LoadOrPublish() of a published name = %v, %v, want the published Int", v, err)
+	}
+
+	_, err := b.LoadOrPublish("requests", new(Float))
+	want := &TypeMismatchError{Name: "requests", Have: "*expvar.Int", Want: "*expvar.Float"}
+	if got, ok := err.(*TypeMismatchError); !ok || *got != *want {
+		t.Errorf("b.LoadOrPublish() of another type = %v, want %v", err, want)
+	}
+	if _, err := b.LoadOrPublish("nil", nil); err != ErrNilVar {
+		t.Errorf("b.LoadOrPublish() of nil = %v, want ErrNilVar", err)
+	}
+}
+
+func TestAsFloat(t *testing.T) {
+	i := new(Int)
+	i.Set(3)
+	f := new(Float)
+	f.Set(1.5)
+	c := new(Counter)
+	c.Add(7)
+	g := new(Gauge)
+	g.Set(-2)
+	s := new(ShardedInt)
+	s.Add(11)
+	d := new(DeltaInt)
+	d.Add(5)
+	e := newEWMA(1)
+	e.Update(4)
+	r := newRate(new(Int), time.Hour)
+	defer r.Stop()
+	gc := newMemStatsField("EnableGC")
+
+	tests := []struct {
+		v    Var
+		want float64
+	}{
+		{i, 3},
+		{f, 1.5},
+		{c, 7},
+		{g, -2},
+		{s, 11},
+		{d, 5},
+		{e, 4},
+		{r, 0},
+		{gc, 1},
+	}
+	for _, tt := range tests {
+		if got, ok := AsFloat(tt.v); !ok || got != tt.want {
+			t.Errorf("AsFloat(%T) = %v, %v, want %v, true", tt.v, got, ok, tt.want)
+		}
+	}
+	if got := d.Value(); got != 5 {
+		t.Errorf("d.Value() after AsFloat = %d, want 5", got)
+	}
+
+	for _, v := range []Var{new(String), new(Map), new(Bool)} {
+		if got, ok := AsFloat(v); ok {
+			t.Errorf("AsFloat(%T) = %v, true, want false", v, got)
+		}
+	}
+}
+
+func TestCounterDrainConcurrent(t *testing.T) {
+	c := new(Counter)
+
+	const producers, perProducer = 4, 10000
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perProducer; j++ {
+				c.Add(3)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var total uint64
+	for {
+		select {
+		case <-done:
+			total += c.Drain()
+			if want := uint64(producers * perProducer * 3); total != want {
+				t.Errorf("total drained = %d, want %d", total, want)
+			}
+			if got := c.Value(); got != 0 {
+				t.Errorf("c.Value() after Drain = %d, want 0", got)
+			}
+			return
+		default:
+			total += c.Drain()
+		}
+	}
+}
+
+func TestBucketAlias(t *testing.T) {
+	public, private := new(Bucket), new(Bucket)
+	c := public.NewInt("requests")
+	private.Alias("requests", c)
+	private.Alias("requests", c) // aliasing the same var again is a no-op
+	private.Alias("reqs", c)
+
+	c.Add(2)
+	private.Get("reqs").(*Int).Add(1)
+	if got := public.Get("requests").String(); got != "3" {
+		t.Errorf("public requests = %s, want 3", got)
+	}
+	if got := private.Get("requests").String(); got != "3" {
+		t.Errorf("private requests = %s, want 3", got)
+	}
+
+	if msg := panicMessage(func() { private.Alias("requests", new(Int)) }); !strings.Contains(msg, "Reuse of exported var name") {
+		t.Errorf("aliasing another var panicked with %q, want a reuse panic", msg)
+	}
+	// Funcs cannot be compared, so aliasing one twice is a reuse.
+	f := Func(func() interface{} { return 1 })
+	private.Alias("f", f)
+	if msg := panicMessage(func() { private.Alias("f", f) }); msg == "" {
+		t.Error("aliasing a Func twice did not panic")
+	}
+}
+
+func TestBucketDoConcurrentPublish(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a")
+	b.NewInt("b")
+	b.NewInt("c")
+
+	var seen []string
+	b.Do(func(kv KeyValue) {
+		seen = append(seen, kv.Key)
+		if kv.Key != "a" {
+			return
+		}
+		// A slow callback must not block Publish and Unpublish.
+		published := make(chan struct{})
+		go func() {
+			b.NewInt("d")
+			b.Unpublish("b")
+			close(published)
+		}()
+		select {
+		case <-published:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Publish blocked by Do")
+		}
+	})
+
+	// b was removed before it was reached, d was added after the snapshot.
+	if want := []string{"a", "c"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("Do visited %v, want %v", seen, want)
+	}
+}
+
+func TestMapIncrFloatBy(t *testing.T) {
+	m := new(Map)
+	m.Add("z", 1)
+
+	for _, tt := range []struct {
+		key   string
+		delta float64
+		want  float64
+	}{
+		{"b", 1.5, 1.5},
+		{"b", 2, 3.5},
+		{"a", -1, -1},
+		{"b", 0.25, 3.75},
+	} {
+		if got := m.IncrFloatBy(tt.key, tt.delta); got != tt.want {
+			t.Errorf("m.IncrFloatBy(%q, %v) = %v, want %v", tt.key, tt.delta, got, tt.want)
+		}
+	}
+	if got, want := m.Keys(), []string{"a", "b", "z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("m.Keys() = %v, want %v", got, want)
+	}
+	if _, ok := m.Get("a").(*Float); !ok {
+		t.Errorf("m.Get(%q) = %T, want *Float", "a", m.Get("a"))
+	}
+
+	// An existing entry of another type is left alone.
+	if got := m.IncrFloatBy("z", 1); got != 0 {
+		t.Errorf("m.IncrFloatBy on an *Int = %v, want 0", got)
+	}
+	if got := m.Get("z").String(); got != "1" {
+		t.Errorf("z = %s, want 1", got)
+	}
+}
+
+func TestNewFuncWithEncoder(t *testing.T) {
+	b := new(Bucket)
+	twoDecimals := func(x interface{}) ([]byte, error) {
+		if f, ok := x.(float64); ok {
+			return []byte(strconv.FormatFloat(f, 'f', 2, 64)), nil
+		}
+		return json.Marshal(x)
+	}
+
+	v := b.NewFuncWithEncoder("pi", func() interface{} { return 3.14159 }, twoDecimals)
+	if got := v.String(); got != "3.14" {
+		t.Errorf("v.String() = %s, want 3.14", got)
+	}
+
+	broken := b.NewFuncWithEncoder("broken", func() interface{} { panic("boom") }, twoDecimals)
+	if got, want := broken.String(), `{"panic":"boom"}`; got != want {
+		t.Errorf("panicking func: String() = %s, want %s", got, want)
+	}
+
+	failing := b.NewFuncWithEncoder("failing", func() interface{} { return 1 }, func(interface{}) ([]byte, error) {
+		return nil, errors.New("no encoding")
+	})
+	if got, want := failing.String(), `{"error":"no encoding"}`; got != want {
+		t.Errorf("failing encoder: String() = %s, want %s", got, want)
+	}
+
+	invalid := b.NewFuncWithEncoder("invalid", func() interface{} { return 1 }, func(interface{}) ([]byte, error) {
+		return []byte("1,"), nil
+	})
+	if got, want := invalid.String(), `{"error":"invalid JSON from encoder: \"1,\""}`; got != want {
+		t.Errorf("invalid encoder output: String() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package expvar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Flags is a set of named boolean flags stored as a bitmask, and satisfies
+// the Var interface. It is rendered as the numeric mask together with an
+// object holding each flag, like {"mask": 5, "flags": {"a": true, ...}}.
+type Flags struct {
+	mask  uint64
+	names []string // bit i is named names[i]
+}
+
+func newFlags(names []string) *Flags {
+	if len(names) > 64 {
+		panic("expvar: Flags supports at most 64 flags")
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			panic("expvar: duplicate flag name " + name)
+		}
+		seen[name] = true
+	}
+	return &Flags{names: append([]string(nil), names...)}
+}
+
+// Value returns the bitmask of v. The i-th flag given to NewFlags is bit i.
+func (v *Flags) Value() uint64 {
+	return atomic.LoadUint64(&v.mask)
+}
+
+// bit returns the mask bit of flag.
+func (v *Flags) bit(flag string) (uint64, error) {
+	for i, name := range v.names {
+		if name == flag {
+			return 1 << uint(i), nil
+		}
+	}
+	return 0, fmt.Errorf("expvar: unknown flag %q", flag)
+}
+
+// Set turns flag on or off. It returns an error if flag is not one of the
+// names v was created with.
+func (v *Flags) Set(flag string, on bool) error {
+	bit, err := v.bit(flag)
+	if err != nil {
+		return err
+	}
+	for {
+		cur := atomic.LoadUint64(&v.mask)
+		nxt := cur &^ bit
+		if on {
+			nxt = cur | bit
+		}
+		if atomic.CompareAndSwapUint64(&v.mask, cur, nxt) {
+			return nil
+		}
+	}
+}
+
+// IsSet reports whether flag is on. It returns an error if flag is not one
+// of the names v was created with.
+func (v *Flags) IsSet(flag string) (bool, error) {
+	bit, err := v.bit(flag)
+	if err != nil {
+		return false, err
+	}
+	return v.Value()&bit != 0, nil
+}
+
+func (v *Flags) String() string {
+	mask := v.Value()
+	var b strings.Builder
+	b.WriteString(`{"mask": `)
+	b.WriteString(strconv.FormatUint(mask, 10))
+	b.WriteString(`, "flags": {`)
+	for i, name := range v.names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteJSON(name))
+		b.WriteString(": ")
+		b.WriteString(strconv.FormatBool(mask&(1<<uint(i)) != 0))
+	}
+	b.WriteString("}}")
+	return b.String()
+}
+
+func (v *Flags) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Flags) clone() Var {
+	return &Flags{mask: v.Value(), names: v.names}
+}
+
+// NewFlags creates and publishes a Flags var with the given flag names, all
+// turned off. It panics if a name is given twice or there are more than 64.
+func NewFlags(name string, names ...string) *Flags {
+	return Default.NewFlags(name, names...)
+}
+
+func (m *Bucket) NewFlags(name string, names ...string) *Flags {
+	if v, ok := m.Get(name).(*Flags); ok {
+		return v
+	}
+
+	v := newFlags(names)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,57 @@
+package expvar
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	b := new(Bucket)
+	f := b.NewFlags("subsystems", "db", "cache", "queue")
+
+	if err := f.Set("db", true); err != nil {
+		t.Fatalf("f.Set(%q, true): %v", "db", err)
+	}
+	if err := f.Set("queue", true); err != nil {
+		t.Fatalf("f.Set(%q, true): %v", "queue", err)
+	}
+	if err := f.Set("disk", true); err == nil {
+		t.Errorf("f.Set(%q, true) succeeded, want an error", "disk")
+	}
+
+	if got := f.Value(); got != 0x5 {
+		t.Errorf("f.Value() = %#x, want 0x5", got)
+	}
+	want := `{"mask": 5, "flags": {"db": true, "cache": false, "queue": true}}`
+	if got := f.String(); got != want {
+		t.Errorf("f.String() = %s, want %s", got, want)
+	}
+	if !json.Valid([]byte(f.String())) {
+		t.Errorf("f.String() = %s is not valid JSON", f.String())
+	}
+
+	f.Set("db", false)
+	if on, err := f.IsSet("db"); on || err != nil {
+		t.Errorf("f.IsSet(%q) = %v, %v, want false, nil", "db", on, err)
+	}
+	if got := f.Value(); got != 0x4 {
+		t.Errorf("f.Value() after clearing db = %#x, want 0x4", got)
+	}
+	if _, err := f.IsSet("disk"); err == nil {
+		t.Errorf("f.IsSet(%q) succeeded, want an error", "disk")
+	}
+}
+
+func TestNewFlagsInvalid(t *testing.T) {
+	if msg := panicMessage(func() { newFlags([]string{"a", "a"}) }); msg == "" {
+		t.Error("duplicate flag name did not panic")
+	}
+	names := make([]string, 65)
+	for i := range names {
+		names[i] = fmt.Sprint("f", i)
+	}
+	if msg := panicMessage(func() { newFlags(names) }); msg == "" {
+		t.Error("65 flags did not panic")
+	}
+}
@@ -0,0 +1,54 @@
+package expvar
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// flatten calls f for v, or, if v is a Map, recursively for each of its
+// entries with the key appended to name using a dot.
+func flatten(name string, v Var, f func(name string, v Var)) {
+	mv, ok := v.(*Map)
+	if !ok {
+		f(name, v)
+		return
+	}
+	mv.Do(func(kv KeyValue) {
+		flatten(name+"."+kv.Key, kv.Value, f)
+	})
+}
+
+// FlatHandler returns an HTTP Handler that serves the variables of m as a
+// single flat JSON object. Maps are not nested but their entries are
+// included as top-level mapname.key entries, recursively for nested Maps.
+//
+// If a flattened name equals another name, for example a var "a.b" next to
+// a Map "a" with key "b", the entry visited last wins. Vars are visited in
+// sorted name order, and Map entries in sorted key order.
+func FlatHandler(m *Bucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vals := make(map[string]string)
+		m.doVisible(func(kv KeyValue) {
+			flatten(kv.Key, kv.Value, func(name string, v Var) {
+				vals[name] = v.String()
+			})
+		})
+
+		names := make([]string, 0, len(vals))
+		for name := range vals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, "{\n")
+		for i, name := range names {
+			if i > 0 {
+				fmt.Fprintf(w, ",\n")
+			}
+			fmt.Fprintf(w, "%s: %s", quoteJSON(name), vals[name])
+		}
+		fmt.Fprintf(w, "\n}\n")
+	})
+}
@@ -0,0 +1,28 @@
+package expvar
+
+import (
+	"testing"
+)
+
+func TestFlatHandler(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(1)
+	m := b.NewMap("http")
+	codes := new(Map)
+	codes.Add("200", 4)
+	codes.Add("404", 1)
+	m.Set("codes", codes)
+	m.Add("errors", 2)
+
+	w := serve(FlatHandler(b), "/")
+	const want = `{
+"http.codes.200": 4,
+"http.codes.404": 1,
+"http.errors": 2,
+"requests": 1
+}
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
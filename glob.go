@@ -0,0 +1,96 @@
+package expvar
+
+import (
+	"path"
+	"strings"
+)
+
+// parseGlob splits pattern into its dot separated segments, and checks
+// that each of them is a valid path.Match pattern.
+func parseGlob(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, ".")
+	for _, seg := range segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// matchSegments matches the dot separated segments of name against the
+// leading segments of glob, and returns the remaining segments.
+func matchSegments(name string, glob []string) ([]string, bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) > len(glob) {
+		return nil, false
+	}
+	for i, part := range parts {
+		if ok, _ := path.Match(glob[i], part); !ok {
+			return nil, false
+		}
+	}
+	return glob[len(parts):], true
+}
+
+// renderGlob renders the parts of v matching the remaining glob segments.
+// Once all segments are matched, v is rendered as a whole. A Map is
+// rendered as an object holding only its matching entries. It returns
+// false if nothing in v matches.
+func renderGlob(v Var, glob []string, opts varsOptions) (string, bool) {
+	if len(glob) == 0 {
+		return opts.scrape(v).String(), true
+	}
+	mv, ok := v.(*Map)
+	if !ok {
+		return "", false
+	}
+
+	var b strings.Builder
+	mv.Do(func(kv KeyValue) {
+		rest, ok := matchSegments(kv.Key, glob)
+		if !ok {
+			return
+		}
+		val, ok := renderGlob(kv.Value, rest, opts)
+		if !ok {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteJSON(kv.Key))
+		b.WriteString(": ")
+		b.WriteString(val)
+	})
+	if b.Len() == 0 {
+		return "", false
+	}
+	return "{" + b.String() + "}", true
+}
+
+// globValue is like renderGlob, but returns the matching parts of v as
+// decoded by snapshotValue, for encoding as MessagePack.
+func globValue(v Var, glob []string, opts varsOptions) (interface{}, bool) {
+	if len(glob) == 0 {
+		return snapshotValue(opts.scrape(v))
+	}
+	mv, ok := v.(*Map)
+	if !ok {
+		return nil, false
+	}
+
+	snap := make(map[string]interface{})
+	mv.Do(func(kv KeyValue) {
+		rest, ok := matchSegments(kv.Key, glob)
+		if !ok {
+			return
+		}
+		if val, ok := globValue(kv.Value, rest, opts); ok {
+			snap[kv.Key] = val
+		}
+	})
+	if len(snap) == 0 {
+		return nil, false
+	}
+	return snap, true
+}
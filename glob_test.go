@@ -0,0 +1,63 @@
+package expvar
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandlerGlob(t *testing.T) {
+	b := new(Bucket)
+	h := b.NewMap("http")
+	for _, endpoint := range []string{"api", "web"} {
+		e := new(Map)
+		e.Add("latency", 5)
+		e.Add("count", 1)
+		h.Set(endpoint, e)
+	}
+	b.NewInt("http.total").Set(7)
+	b.NewInt("other")
+
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"http.*.latency", "{\n\"http\": {\"api\": {\"latency\": 5}, \"web\": {\"latency\": 5}}\n}\n"},
+		{"http.api.*", "{\n\"http\": {\"api\": {\"count\": 1, \"latency\": 5}}\n}\n"},
+		{"http.t*", "{\n\"http.total\": 7\n}\n"},
+		{"o*", "{\n\"other\": 0\n}\n"},
+		{"none.*", "{\n\n}\n"},
+	}
+	for _, tt := range tests {
+		w := serve(HandlerFor(b), "/?glob="+tt.glob)
+		if w.Code != http.StatusOK {
+			t.Errorf("glob %s: status = %d, want %d", tt.glob, w.Code, http.StatusOK)
+		}
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("glob %s: body = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+
+	if w := serve(HandlerFor(b), "/?glob=http.[a"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid glob: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w := serve(HandlerFor(b), "/?glob=http.*.latency", "Accept", "application/msgpack")
+	doc, _, err := decodeMsgpack(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decoding MessagePack % x: %v", w.Body.Bytes(), err)
+	}
+	want := map[string]interface{}{"http": map[string]interface{}{
+		"api": map[string]interface{}{"latency": int64(5)},
+		"web": map[string]interface{}{"latency": int64(5)},
+	}}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("MessagePack glob: got %v, want %v", doc, want)
+	}
+
+	body := serve(HandlerFor(b), "/?glob=http.t*", "Accept", "text/html").Body.String()
+	if !strings.Contains(body, "?var=http.total") || strings.Contains(body, "?var=http\"") || strings.Contains(body, "?var=other") {
+		t.Errorf("HTML index with glob = %q, want only http.total listed", body)
+	}
+}
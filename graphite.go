@@ -0,0 +1,85 @@
+package expvar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteNameReplacer replaces the characters that separate the fields of
+// the Graphite plaintext protocol.
+var graphiteNameReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_")
+
+// PushGraphite sends the numeric variables of m to the Graphite server at
+// addr every interval, until ctx is done, using the plaintext protocol over
+// TCP. Each var is sent as prefix.name, and the numeric entries of a Map as
+// prefix.name.key. If prefix is empty the names are sent as is. The options
+// can add jitter and backoff to the interval. It panics if interval is not
+// positive.
+//
+// The connection is opened on the first push. Each push has to be written
+// within interval. If a push fails the connection is closed and a new one
+// is dialed on the next push.
+// PushGraphite blocks until ctx is done and then returns ctx.Err().
+func PushGraphite(ctx context.Context, m *Bucket, addr, prefix string, interval time.Duration, opts ...PushOption) error {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var d net.Dialer
+	sched := newPushSchedule(interval, opts)
+	timer := time.NewTimer(sched.next(nil))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			var err error
+			if conn == nil {
+				conn, err = d.DialContext(ctx, "tcp", addr)
+			}
+			if err == nil {
+				// A server that stops reading must not stall the pusher.
+				conn.SetWriteDeadline(time.Now().Add(interval))
+				if _, err = conn.Write(graphiteLines(m, prefix, time.Now())); err != nil {
+					conn.Close()
+					conn = nil
+				}
+			}
+			timer.Reset(sched.next(err))
+		}
+	}
+}
+
+// graphiteLines renders the numeric variables of m as Graphite plaintext
+// lines with timestamp now.
+func graphiteLines(m *Bucket, prefix string, now time.Time) []byte {
+	if prefix != "" {
+		prefix += "."
+	}
+
+	var buf bytes.Buffer
+	ts := now.Unix()
+	for _, family := range collectMetrics(m) {
+		for _, s := range family.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			name := prefix + family.Name
+			if s.Key != "" {
+				name += "." + s.Key
+			}
+			fmt.Fprintf(&buf, "%s %s %d\n", graphiteNameReplacer.Replace(name), strconv.FormatFloat(s.Value, 'g', -1, 64), ts)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,106 @@
+package expvar
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphiteLines(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(3)
+	b.NewMap("latency").AddFloat("p 99", 2.5)
+	b.NewString("version").Set("1.0")
+
+	got := string(graphiteLines(b, "app", time.Unix(1500000000, 0)))
+	want := "app.latency.p_99 2.5 1500000000\napp.requests 3 1500000000\n"
+	if got != want {
+		t.Errorf("graphiteLines = %q, want %q", got, want)
+	}
+}
+
+// acceptGraphite accepts the next connection on ln, or fails the test if
+// none arrives in time.
+func acceptGraphite(t *testing.T, ln net.Listener) net.Conn {
+	t.Helper()
+	c := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			c <- conn
+		}
+	}()
+	select {
+	case conn := <-c:
+		return conn
+	case <-time.After(10 * time.Second):
+		t.Fatal("no connection from the pusher")
+	}
+	return nil
+}
+
+func TestPushGraphiteReconnect(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(3)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- PushGraphite(ctx, b, ln.Addr().String(), "app", 10*time.Millisecond)
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn := acceptGraphite(t, ln)
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("connection %d: %v", i, err)
+		}
+		if !strings.HasPrefix(line, "app.requests 3 ") {
+			t.Errorf("connection %d: line = %q, want app.requests 3 <timestamp>", i, line)
+		}
+		// Closing the connection makes the pusher dial a new one.
+		conn.Close()
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("PushGraphite = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPushGraphiteStalledServer(t *testing.T) {
+	// Pushes large enough to fill the socket buffers of a server that
+	// never reads.
+	b := new(Bucket)
+	m := b.NewMap("m")
+	for i := 0; i < 20000; i++ {
+		m.Add(fmt.Sprintf("key%05d", i), 1)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go PushGraphite(ctx, b, ln.Addr().String(), "", 10*time.Millisecond)
+
+	stalled := acceptGraphite(t, ln)
+	defer stalled.Close()
+	// The write deadline fails the blocked push, after which the pusher
+	// dials again.
+	acceptGraphite(t, ln).Close()
+}
@@ -0,0 +1,97 @@
+package expvar
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Group is a set of named *Int variables that are updated together, and
+// satisfies the Var interface. It is rendered as a JSON object holding each
+// Int. A reader never sees only part of the changes made by an Update.
+type Group struct {
+	mu    sync.RWMutex
+	ints  map[string]*Int
+	names []string // sorted
+}
+
+func newGroup(names []string) *Group {
+	g := &Group{ints: make(map[string]*Int, len(names))}
+	for _, name := range names {
+		if _, dup := g.ints[name]; dup {
+			panic("expvar: duplicate Group name " + name)
+		}
+		g.ints[name] = new(Int)
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+	return g
+}
+
+// Update calls f with the Ints of the group, holding a lock that keeps the
+// group from being rendered until f returns. f must not add or remove
+// entries of the map, or keep it after returning.
+func (v *Group) Update(f func(map[string]*Int)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	f(v.ints)
+}
+
+// Values returns the current values of the Ints of the group.
+func (v *Group) Values() map[string]int64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	vals := make(map[string]int64, len(v.ints))
+	for name, iv := range v.ints {
+		vals[name] = iv.Value()
+	}
+	return vals
+}
+
+func (v *Group) String() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var b strings.Builder
+	b.WriteString("{")
+	for i, name := range v.names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteJSON(name))
+		b.WriteString(": ")
+		b.WriteString(v.ints[name].String())
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (v *Group) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Group) clone() Var {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	c := &Group{ints: make(map[string]*Int, len(v.ints)), names: v.names}
+	for name, iv := range v.ints {
+		c.ints[name] = new(Int)
+		c.ints[name].Set(iv.Value())
+	}
+	return c
+}
+
+// NewGroup creates and publishes a Group holding an Int for each of the
+// given names. It panics if a name is given twice.
+func NewGroup(name string, names ...string) *Group {
+	return Default.NewGroup(name, names...)
+}
+
+func (m *Bucket) NewGroup(name string, names ...string) *Group {
+	if v, ok := m.Get(name).(*Group); ok {
+		return v
+	}
+
+	v := newGroup(names)
+	m.publishNew(name, v)
+	return v
+}
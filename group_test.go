@@ -0,0 +1,40 @@
+package expvar
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGroupUpdateConsistent(t *testing.T) {
+	g := new(Bucket).NewGroup("requests", "total", "success", "bytes")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			g.Update(func(m map[string]*Int) {
+				m["total"].Add(1)
+				m["success"].Add(1)
+				m["bytes"].Add(10)
+			})
+		}
+	}()
+
+	for {
+		var doc map[string]int64
+		if err := json.Unmarshal([]byte(g.String()), &doc); err != nil {
+			t.Fatalf("invalid JSON %s: %v", g.String(), err)
+		}
+		if doc["success"] != doc["total"] || doc["bytes"] != 10*doc["total"] {
+			t.Fatalf("g.String() shows a partial update: %v", doc)
+		}
+		select {
+		case <-done:
+			if got := g.Values()["total"]; got != 2000 {
+				t.Errorf("total = %d, want 2000", got)
+			}
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,663 @@
+package expvar
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func expvarHandler(w http.ResponseWriter, r *http.Request) {
+	HandlerFor(Default).ServeHTTP(w, r)
+}
+
+// HandlerFor returns an HTTP Handler that serves the variables of m.
+func HandlerFor(m *Bucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveVars(m, w, r, handlerConfig{})
+	})
+}
+
+// HandlerWithLimit returns an HTTP Handler that serves the variables of m
+// like HandlerFor, but stops adding variables to a response once it would
+// grow beyond maxBytes. A truncated JSON or MessagePack response ends with
+// a "_truncated": true member so it can still be decoded, and a truncated
+// HTML index ends with a note. A Map is cut short the same way, with a
+// "_truncated": true member of its own. A single var selected with the var
+// query parameter cannot be cut short, so one larger than maxBytes is
+// answered with 413 Request Entity Too Large. The limit applies to the
+// unindented output.
+func HandlerWithLimit(m *Bucket, maxBytes int) http.Handler {
+	if maxBytes <= 0 {
+		panic("expvar: HandlerWithLimit maxBytes must be positive")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveVars(m, w, r, handlerConfig{limit: maxBytes})
+	})
+}
+
+// HandlerWithContentType returns an HTTP Handler that serves the variables
+// of m like HandlerFor, but with contentType as the Content-Type of JSON
+// responses instead of "application/json; charset=utf-8". It panics if
+// contentType is empty.
+func HandlerWithContentType(m *Bucket, contentType string) http.Handler {
+	if contentType == "" {
+		panic("expvar: HandlerWithContentType contentType must not be empty")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveVars(m, w, r, handlerConfig{contentType: contentType})
+	})
+}
+
+// AuthHandler returns an HTTP Handler that serves the variables of m like
+// HandlerFor, but only for requests for which authorize returns true. All
+// other requests get a 403 Forbidden response.
+func AuthHandler(m *Bucket, authorize func(*http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		serveVars(m, w, r, handlerConfig{})
+	})
+}
+
+// callbackPattern matches the JSONP callback names accepted by the handler.
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.]*$`)
+
+// maxIndent is the largest indent accepted by the indent query parameter.
+const maxIndent = 8
+
+// handlerConfig holds the settings of a handler that serves vars.
+type handlerConfig struct {
+	limit       int    // approximate maximum JSON size in bytes, 0 if unlimited
+	contentType string // Content-Type of JSON responses, if not the default
+}
+
+// varsOptions selects which variables the handler writes, and how.
+type varsOptions struct {
+	prefix   string   // only names starting with prefix
+	indent   int      // indent in spaces, 0 for compact output
+	limit    int      // approximate maximum size in bytes, 0 if unlimited
+	glob     []string // only the parts matching these segments, if not nil
+	byValue  bool     // order numeric vars by value instead of by name
+	desc     bool     // reverse the order of numeric vars when byValue is set
+	callback string   // JSONP function to wrap JSON output in, if not empty
+	peek     bool     // leave Snapshotters as they are and track no accesses
+}
+
+// serveVars writes all variables of m as a JSON object. If the prefix query
+// parameter is set, only variables whose name starts with it are included.
+// If the var query parameter is set, only the value of that variable is
+// written, or a 404 if it does not exist. The indent (or pretty) query
+// parameter selects indented output. The sort=value query parameter
+// writes numeric vars first, ordered by their value, ascending or as
+// selected by order=asc or order=desc, followed by all other vars by name.
+// Since JSON objects are unordered this only affects the order in which
+// the members appear in the output. The glob query parameter selects the
+// parts matching a pattern like "http.*.latency", where each dot separated
+// segment is matched with path.Match against a segment of a var name or
+// Map key, descending into Maps; an invalid pattern is a 400. The index
+// page then only lists the vars holding a match. If the callback query parameter is set, the JSON is
+// wrapped in a JSONP call to that function. Clients that accept text/html
+// get an index page linking to each variable instead. The response is gzip
+// compressed when the client accepts it, and carries an ETag and
+// Last-Modified header for conditional requests. Answering a request with
+// 304 Not Modified neither resets Snapshotters nor counts as an access.
+// The limit of cfg applies to all formats, its content type to JSON
+// output.
+func serveVars(m *Bucket, w http.ResponseWriter, r *http.Request, cfg handlerConfig) {
+	q := r.URL.Query()
+	opts := varsOptions{
+		prefix: q.Get("prefix"),
+		indent: indentParam(r),
+		limit:  cfg.limit,
+	}
+
+	callback := q.Get("callback")
+	if callback != "" && !callbackPattern.MatchString(callback) {
+		http.Error(w, "invalid callback name", http.StatusBadRequest)
+		return
+	}
+
+	if pattern := q.Get("glob"); pattern != "" {
+		glob, err := parseGlob(pattern)
+		if err != nil {
+			http.Error(w, "invalid glob: "+pattern, http.StatusBadRequest)
+			return
+		}
+		opts.glob = glob
+	}
+
+	switch q.Get("sort") {
+	case "", "key":
+	case "value":
+		opts.byValue = true
+	default:
+		http.Error(w, "invalid sort: "+q.Get("sort"), http.StatusBadRequest)
+		return
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.desc = true
+	default:
+		http.Error(w, "invalid order: "+q.Get("order"), http.StatusBadRequest)
+		return
+	}
+
+	var single Var
+	name := q.Get("var")
+	if name != "" {
+		if single = m.Get(name); single == nil || isHidden(m, name) {
+			http.Error(w, "unknown var: "+name, http.StatusNotFound)
+			return
+		}
+	}
+	opts.callback = callback
+
+	// A single var cannot be truncated, so one over the limit is refused.
+	// It is measured by a peek, so refusing it consumes nothing.
+	if single != nil && cfg.limit > 0 {
+		peek := opts
+		peek.peek = true
+		peek.indent = 0
+		body, _, err := renderVars(r, m, single, peek, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(body) > cfg.limit {
+			http.Error(w, "var too large: "+name, http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	// A conditional request is first checked against a rendering that
+	// leaves Snapshotters untouched, so that answering it with 304 Not
+	// Modified does not consume them.
+	if isConditional(r) {
+		peek := opts
+		peek.peek = true
+		body, contentType, err := renderVars(r, m, single, peek, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tag, modified := m.etags.lookup(r.URL.RawQuery+"\x00"+contentType, body)
+		if notModified(r, tag, modified) {
+			setVarsHeaders(w, contentType, tag, modified)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	body, contentType, err := renderVars(r, m, single, opts, cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if single != nil {
+		m.accesses.track(name)
+	}
+	tag, modified := m.etags.lookup(r.URL.RawQuery+"\x00"+contentType, body)
+	setVarsHeaders(w, contentType, tag, modified)
+
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	out.Write(body)
+}
+
+// renderVars returns the response body for the request r selecting single,
+// or if it is nil, the variables of m selected by opts, and its content
+// type.
+func renderVars(r *http.Request, m *Bucket, single Var, opts varsOptions, cfg handlerConfig) ([]byte, string, error) {
+	var body bytes.Buffer
+	var contentType string
+	switch {
+	case opts.callback != "":
+		contentType = "application/javascript; charset=utf-8"
+		fmt.Fprintf(&body, "%s(", opts.callback)
+		writeJSON(&body, m, single, opts)
+		fmt.Fprintf(&body, ");\n")
+	case single == nil && accepts(r, "Accept", "text/html"):
+		contentType = "text/html; charset=utf-8"
+		writeIndex(&body, m, opts)
+	case accepts(r, "Accept", "application/msgpack"):
+		contentType = "application/msgpack"
+		packed, err := msgpackVars(m, single, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		body.Write(packed)
+	default:
+		contentType = "application/json; charset=utf-8"
+		if cfg.contentType != "" {
+			contentType = cfg.contentType
+		}
+		writeJSON(&body, m, single, opts)
+	}
+	return body.Bytes(), contentType, nil
+}
+
+// setVarsHeaders sets the headers common to all responses of the handler.
+func setVarsHeaders(w http.ResponseWriter, contentType, tag string, modified time.Time) {
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+}
+
+// writeJSON writes single, or if it is nil, the variables of m selected by
+// opts to w as JSON.
+func writeJSON(w io.Writer, m *Bucket, single Var, opts varsOptions) {
+	if opts.indent > 0 {
+		var buf, dst bytes.Buffer
+		compact := opts
+		compact.indent = 0
+		writeJSON(&buf, m, single, compact)
+		if err := json.Indent(&dst, buf.Bytes(), "", strings.Repeat(" ", opts.indent)); err != nil {
+			// Some var did not produce valid JSON; serve it as is.
+			buf.WriteTo(w)
+			return
+		}
+		dst.WriteTo(w)
+		return
+	}
+
+	if single != nil {
+		io.WriteString(w, opts.scrape(single).String())
+		return
+	}
+	writeVars(w, m, opts)
+}
+
+// selectVars returns the variables of m whose name starts with the prefix
+// of opts, in the order selected by opts.
+func selectVars(m *Bucket, opts varsOptions) []KeyValue {
+	var kvs []KeyValue
+	m.doVisible(func(kv KeyValue) {
+		if strings.HasPrefix(kv.Key, opts.prefix) {
+			kvs = append(kvs, kv)
+		}
+	})
+	if !opts.byValue {
+		return kvs
+	}
+
+	// NaN values are not ordered, so they go with the non-numeric vars.
+	value := func(v Var) (float64, bool) {
+		f, ok := AsFloat(v)
+		return f, ok && !math.IsNaN(f)
+	}
+	sort.SliceStable(kvs, func(i, j int) bool {
+		fi, iok := value(kvs[i].Value)
+		fj, jok := value(kvs[j].Value)
+		switch {
+		case !iok || !jok:
+			return iok && !jok
+		case opts.desc:
+			return fi > fj
+		}
+		return fi < fj
+	})
+	return kvs
+}
+
+// writeVars writes the variables of m selected by opts to w as a JSON
+// object. If the limit of opts is positive, variables that would make the
+// output longer than limit bytes are left out, and the object ends with a
+// truncation marker instead. A Map that does not fit is rendered as far as
+// it does, and then ends with a truncation marker of its own. Variables
+// left out are neither snapshotted nor counted as accessed.
+func writeVars(w io.Writer, m *Bucket, opts varsOptions) {
+	const marker = `"_truncated": true`
+	fmt.Fprintf(w, "{\n")
+	n := len("{\n") + len("\n}\n")
+	first := true
+	truncated := false
+	format := func(key, val string) string {
+		if first {
+			return fmt.Sprintf("%s: %s", quoteJSON(key), val)
+		}
+		return fmt.Sprintf(",\n%s: %s", quoteJSON(key), val)
+	}
+	for _, kv := range selectVars(m, opts) {
+		if v, ok := kv.Value.(*Map); ok && opts.limit > 0 && opts.glob == nil {
+			// A Map is rendered only as far as the remaining budget
+			// allows, rather than measured in full first.
+			budget := opts.limit - n - len(format(kv.Key, "")) - len(",\n"+marker)
+			val, complete := renderMapLimit(v, budget)
+			if val != "" {
+				if !opts.peek {
+					m.accesses.track(kv.Key)
+				}
+				entry := format(kv.Key, val)
+				n += len(entry)
+				io.WriteString(w, entry)
+				first = false
+			}
+			if !complete {
+				truncated = true
+				break
+			}
+			continue
+		}
+
+		// With a limit, a var is measured by a peek before it is served.
+		measure := opts
+		measure.peek = opts.peek || opts.limit > 0
+		val, ok := renderVar(kv, measure)
+		if !ok {
+			continue
+		}
+		entry := format(kv.Key, val)
+		if opts.limit > 0 && n+len(entry)+len(",\n"+marker) > opts.limit {
+			truncated = true
+			break
+		}
+		if _, snap := kv.Value.(Snapshotter); measure.peek && !opts.peek && (snap || opts.glob != nil) {
+			if val, ok = renderVar(kv, opts); !ok {
+				continue
+			}
+			entry = format(kv.Key, val)
+		}
+		if !opts.peek {
+			m.accesses.track(kv.Key)
+		}
+		n += len(entry)
+		io.WriteString(w, entry)
+		first = false
+	}
+	if truncated {
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		io.WriteString(w, marker)
+	}
+	fmt.Fprintf(w, "\n}\n")
+}
+
+// renderMapLimit returns the JSON of v like its String method, as far as it
+// fits in budget bytes. If not all entries fit, the object ends with a
+// "_truncated": true member and complete is false. It returns an empty
+// string if not even that fits.
+func renderMapLimit(v *Map, budget int) (val string, complete bool) {
+	const marker = `"_truncated": true`
+	var b strings.Builder
+	b.WriteString("{")
+	complete = true
+	var pending string // the last entry, if it only fits without the marker
+	v.DoWhile(func(kv KeyValue) bool {
+		raw, err := json.Marshal(kv.Value)
+		if err != nil {
+			return true
+		}
+		if pending != "" {
+			complete = false
+			return false
+		}
+		entry := quoteJSON(kv.Key) + ": " + string(raw)
+		if b.Len() > 1 {
+			entry = ", " + entry
+		}
+		switch {
+		case b.Len()+len(entry)+len(", "+marker+"}") <= budget:
+			b.WriteString(entry)
+		case b.Len()+len(entry)+len("}") <= budget:
+			pending = entry
+		default:
+			complete = false
+			return false
+		}
+		return true
+	})
+	if complete {
+		b.WriteString(pending)
+		b.WriteString("}")
+	} else {
+		if b.Len() > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString(marker + "}")
+	}
+	if b.Len() > budget {
+		return "", false
+	}
+	return b.String(), complete
+}
+
+// renderVar returns the JSON the handler serves for kv with opts. It
+// returns false if the glob of opts matches nothing in kv.
+func renderVar(kv KeyValue, opts varsOptions) (string, bool) {
+	if opts.glob == nil {
+		return opts.scrape(kv.Value).String(), true
+	}
+	rest, ok := matchSegments(kv.Key, opts.glob)
+	if !ok {
+		return "", false
+	}
+	return renderGlob(kv.Value, rest, opts)
+}
+
+// WriteTo writes the variables of m to w as a JSON object, like the
+// handler does for a request without query parameters. Unlike the handler,
+// it leaves Snapshotters such as DeltaInt as they are and does not count as
+// an access, so it can be used for logging without affecting scrapes. The
+// output is streamed to w var by var. It returns the number of bytes
+// written and the first error encountered; nothing is written after an
+// error.
+func (m *Bucket) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	writeVars(cw, m, varsOptions{peek: true})
+	return cw.n, cw.err
+}
+
+// countingWriter counts the bytes written to w, and drops all writes after
+// the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// writeIndex writes an HTML page to w listing the variables of m selected
+// by opts, each linking to the var query for it. If the limit of opts is
+// positive, the list stops before the page grows longer than limit bytes
+// and ends with a truncation note.
+func writeIndex(w io.Writer, m *Bucket, opts varsOptions) {
+	const (
+		header = "<!DOCTYPE html>\n<html>\n<head><title>vars</title></head>\n<body>\n<ul>\n"
+		footer = "</ul>\n</body>\n</html>\n"
+		marker = "<li><em>truncated</em></li>\n"
+	)
+	io.WriteString(w, header)
+	n := len(header) + len(footer)
+	match := opts
+	match.peek = true
+	for _, kv := range selectVars(m, opts) {
+		if opts.glob != nil {
+			if _, ok := renderVar(kv, match); !ok {
+				continue
+			}
+		}
+		item := fmt.Sprintf("<li><a href=\"?var=%s\">%s</a></li>\n",
+			html.EscapeString(url.QueryEscape(kv.Key)), html.EscapeString(kv.Key))
+		if opts.limit > 0 && n+len(item)+len(marker) > opts.limit {
+			io.WriteString(w, marker)
+			break
+		}
+		n += len(item)
+		io.WriteString(w, item)
+	}
+	io.WriteString(w, footer)
+}
+
+// scrape returns the Var the handler serves for v.
+func scrape(v Var) Var {
+	if s, ok := v.(Snapshotter); ok {
+		return s.Snapshot()
+	}
+	return v
+}
+
+// scrape returns the Var to render for v: v itself if opts is a peek,
+// otherwise the Var the handler serves for it.
+func (opts varsOptions) scrape(v Var) Var {
+	if opts.peek {
+		return v
+	}
+	return scrape(v)
+}
+
+// indentParam returns the indent requested by the indent or pretty query
+// parameters of r, capped at maxIndent. It returns 0 if none was requested.
+func indentParam(r *http.Request) int {
+	q := r.URL.Query()
+	if s := q.Get("indent"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0
+		}
+		if n > maxIndent {
+			return maxIndent
+		}
+		return n
+	}
+	if b, _ := strconv.ParseBool(q.Get("pretty")); b {
+		return 2
+	}
+	return 0
+}
+
+// msgpackVars returns the MessagePack encoding of single, or if it is nil,
+// of the variables of m selected by opts. Like writeVars, it leaves out
+// the variables that would make the output longer than the limit of opts,
+// and then ends the map with a "_truncated": true entry.
+func msgpackVars(m *Bucket, single Var, opts varsOptions) ([]byte, error) {
+	if single != nil {
+		val, _ := snapshotValue(opts.scrape(single))
+		return appendMsgpack(nil, val)
+	}
+
+	const maxHeader = 5 // map 32 header
+	marker := append(appendMsgpackString(nil, "_truncated"), 0xc3)
+	var entries []byte
+	count := 0
+	truncated := false
+	for _, kv := range selectVars(m, opts) {
+		// With a limit, a var is measured by a peek before it is served.
+		measure := opts
+		measure.peek = opts.peek || opts.limit > 0
+		entry, ok, err := msgpackEntry(kv, measure)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if opts.limit > 0 && maxHeader+len(entries)+len(entry)+len(marker) > opts.limit {
+			truncated = true
+			break
+		}
+		if _, snap := kv.Value.(Snapshotter); measure.peek && !opts.peek && (snap || opts.glob != nil) {
+			if entry, ok, err = msgpackEntry(kv, opts); err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if !opts.peek {
+			m.accesses.track(kv.Key)
+		}
+		entries = append(entries, entry...)
+		count++
+	}
+	if truncated {
+		entries = append(entries, marker...)
+		count++
+	}
+	b := appendMsgpackHeader(nil, count, 0x80, 0xde, 0xdf)
+	return append(b, entries...), nil
+}
+
+// msgpackEntry returns the MessagePack encoding of the name and the value
+// of kv as served with opts. It returns false if the value is not valid
+// JSON, or the glob of opts matches nothing in kv.
+func msgpackEntry(kv KeyValue, opts varsOptions) ([]byte, bool, error) {
+	var val interface{}
+	var ok bool
+	if opts.glob == nil {
+		val, ok = snapshotValue(opts.scrape(kv.Value))
+	} else if rest, match := matchSegments(kv.Key, opts.glob); match {
+		val, ok = globValue(kv.Value, rest, opts)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	b, err := appendMsgpack(appendMsgpackString(nil, kv.Key), val)
+	return b, err == nil, err
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r lists gzip
+// with a non-zero quality.
+func acceptsGzip(r *http.Request) bool {
+	return accepts(r, "Accept-Encoding", "gzip")
+}
+
+// accepts reports whether the given header of r lists value with a
+// non-zero quality.
+func accepts(r *http.Request, header, value string) bool {
+	for _, h := range r.Header[header] {
+		for _, item := range strings.Split(h, ",") {
+			params := strings.Split(item, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), value) {
+				continue
+			}
+
+			accepted := true
+			for _, p := range params[1:] {
+				if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") {
+					f, err := strconv.ParseFloat(q[2:], 64)
+					accepted = err == nil && f > 0
+				}
+			}
+			return accepted
+		}
+	}
+	return false
+}
+
+// Handler returns the expvar HTTP Handler.
+//
+// This is only needed to install the handler in a non-standard location.
+func Handler() http.Handler {
+	return http.HandlerFunc(expvarHandler)
+}
@@ -0,0 +1,689 @@
+package expvar
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serve issues a GET request for target to h, with the given header names
+// and values, and returns the recorded response.
+func serve(h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeKeys returns the sorted member names of the JSON object in body.
+func decodeKeys(t *testing.T, body []byte) []string {
+	t.Helper()
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestHandlerPrefix(t *testing.T) {
+	for _, name := range []string{"prefixtest.http.requests", "prefixtest.http.errors", "prefixtest.db.queries"} {
+		NewInt(name)
+		defer Default.Unpublish(name)
+	}
+	h := Handler()
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/?prefix=prefixtest.", []string{"prefixtest.db.queries", "prefixtest.http.errors", "prefixtest.http.requests"}},
+		{"/?prefix=prefixtest.http.", []string{"prefixtest.http.errors", "prefixtest.http.requests"}},
+		{"/?prefix=none", []string{}},
+	}
+	for _, tt := range tests {
+		w := serve(h, tt.target)
+		if got := decodeKeys(t, w.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET %s: keys = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerFor(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(1)
+
+	w := serve(HandlerFor(b), "/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/json; charset=utf-8")
+	}
+	// Only the vars of b are served, not those of Default.
+	if got, want := decodeKeys(t, w.Body.Bytes()), []string{"requests"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestHandlerGzip(t *testing.T) {
+	b := new(Bucket)
+	b.NewString("greeting").Set("hello")
+	h := HandlerFor(b)
+
+	plain := serve(h, "/").Body.String()
+
+	w := serve(h, "/", "Accept-Encoding", "deflate, gzip")
+	if ce := w.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader failed: %v", err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip body failed: %v", err)
+	}
+	if string(body) != plain {
+		t.Errorf("decompressed body = %q, want %q", body, plain)
+	}
+
+	for _, ae := range []string{"", "deflate", "gzip;q=0"} {
+		w := serve(h, "/", "Accept-Encoding", ae)
+		if ce := w.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want none", ae, ce)
+		}
+	}
+}
+
+func TestHandlerIndent(t *testing.T) {
+	b := new(Bucket)
+	b.NewMap("map").Add("a", 1)
+	h := HandlerFor(b)
+
+	tests := []struct {
+		target string
+		indent string // expected indent of the top-level members, "" if compact
+	}{
+		{"/", ""},
+		{"/?indent=0", ""},
+		{"/?indent=x", ""},
+		{"/?indent=4", "    "},
+		{"/?indent=100", strings.Repeat(" ", maxIndent)},
+		{"/?pretty=1", "  "},
+		{"/?pretty=false", ""},
+	}
+	for _, tt := range tests {
+		body := serve(h, tt.target).Body.String()
+		if !json.Valid([]byte(body)) {
+			t.Errorf("GET %s: invalid JSON %q", tt.target, body)
+			continue
+		}
+		if tt.indent == "" {
+			if want := "{\n\"map\": {\"a\": 1}\n}\n"; body != want {
+				t.Errorf("GET %s: body = %q, want %q", tt.target, body, want)
+			}
+			continue
+		}
+		want := "{\n" + tt.indent + "\"map\": {\n" + tt.indent + tt.indent + "\"a\": 1\n" + tt.indent + "}\n}\n"
+		if body != want {
+			t.Errorf("GET %s: body = %q, want %q", tt.target, body, want)
+		}
+	}
+}
+
+func TestHandlerSingleVar(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(42)
+	m := b.NewMap("codes")
+	m.Add("200", 1)
+	h := HandlerFor(b)
+
+	for _, name := range []string{"requests", "codes"} {
+		w := serve(h, "/?var="+name)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET ?var=%s: status = %d, want %d", name, w.Code, http.StatusOK)
+		}
+		if got, want := w.Body.String(), b.Get(name).String(); got != want {
+			t.Errorf("GET ?var=%s: body = %q, want %q", name, got, want)
+		}
+	}
+
+	if w := serve(h, "/?var=missing"); w.Code != http.StatusNotFound {
+		t.Errorf("GET ?var=missing: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// A single var is indented like the whole document.
+	if got, want := serve(h, "/?var=codes&indent=2").Body.String(), "{\n  \"200\": 1\n}"; got != want {
+		t.Errorf("GET ?var=codes&indent=2: body = %q, want %q", got, want)
+	}
+}
+
+func TestHandlerTimeoutFunc(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	b := new(Bucket)
+	b.NewInt("requests").Set(1)
+	b.Publish("slow", TimeoutFunc(func() interface{} {
+		<-release
+		return "done"
+	}, 10*time.Millisecond))
+
+	start := time.Now()
+	w := serve(HandlerFor(b), "/")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handler took %v, want it to return promptly", elapsed)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.Bytes(), err)
+	}
+	if got := doc["slow"]; got != "<timeout>" {
+		t.Errorf("slow = %v, want <timeout>", got)
+	}
+	if got := doc["requests"]; got != 1.0 {
+		t.Errorf("requests = %v, want 1", got)
+	}
+}
+
+func TestTimeoutFuncFast(t *testing.T) {
+	f := TimeoutFunc(func() interface{} { return 1 }, time.Minute)
+	if got := f.String(); got != "1" {
+		t.Errorf("f.String() = %s, want 1", got)
+	}
+}
+
+func TestTimeoutFuncSingleFlight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	f := TimeoutFunc(func() interface{} {
+		n := atomic.AddInt32(&calls, 1)
+		<-release
+		return n
+	}, 10*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if got := f(); got != "<timeout>" {
+			t.Errorf("f() = %v, want <timeout>", got)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("calls = %d while the first is running, want 1", got)
+	}
+
+	// Once released, the running call returns 1 and a later call may have
+	// started a second one; either value is served.
+	close(release)
+	got := f()
+	for deadline := time.Now().Add(time.Second); got == "<timeout>" && time.Now().Before(deadline); {
+		got = f()
+	}
+	if got != int32(1) && got != int32(2) {
+		t.Errorf("f() = %v after release, want 1 or 2", got)
+	}
+}
+
+func TestHandlerJSONP(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(1)
+	h := HandlerFor(b)
+
+	w := serve(h, "/?callback=app.update")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct, want := w.Header().Get("Content-Type"), "application/javascript; charset=utf-8"; ct != want {
+		t.Errorf("Content-Type = %q, want %q", ct, want)
+	}
+	if got, want := w.Body.String(), "app.update({\n\"requests\": 1\n}\n);\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	for _, callback := range []string{"alert(1)//", "1abc", "a-b", "<script>"} {
+		w := serve(h, "/?callback="+url.QueryEscape(callback))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("callback %q: status = %d, want %d", callback, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(1)
+	h := AuthHandler(b, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	})
+
+	w := serve(h, "/", "Authorization", "Bearer secret")
+	if w.Code != http.StatusOK {
+		t.Errorf("allowed request: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := decodeKeys(t, w.Body.Bytes()), []string{"requests"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("allowed request: keys = %v, want %v", got, want)
+	}
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		w := serve(h, "/", "Authorization", auth)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, http.StatusForbidden)
+		}
+		if strings.Contains(w.Body.String(), "requests") {
+			t.Errorf("Authorization %q: body %q leaks vars", auth, w.Body.String())
+		}
+	}
+}
+
+func TestHandlerDeltaInt(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewDeltaInt("requests")
+	v.Add(3)
+	h := HandlerFor(b)
+
+	for i, want := range []string{"{\n\"requests\": 3\n}\n", "{\n\"requests\": 0\n}\n"} {
+		if got := serve(h, "/").Body.String(); got != want {
+			t.Errorf("scrape %d: body = %q, want %q", i+1, got, want)
+		}
+	}
+
+	v.Increment()
+	if got := serve(h, "/?var=requests").Body.String(); got != "1" {
+		t.Errorf("scrape of the single var = %q, want 1", got)
+	}
+	if got := v.Value(); got != 0 {
+		t.Errorf("v.Value() after scrape = %d, want 0", got)
+	}
+}
+
+func TestHideDefaults(t *testing.T) {
+	defer atomic.StoreInt32(&defaultsHidden, 0)
+
+	present := func(name string, body []byte) bool {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			t.Fatalf("%s: invalid JSON %q: %v", name, body, err)
+		}
+		if props, ok := doc["properties"].(map[string]interface{}); ok {
+			doc = props
+		}
+		_, cmdline := doc["cmdline"]
+		_, memstats := doc["memstats"]
+		return cmdline || memstats
+	}
+	marshal := func() []byte {
+		data, err := json.Marshal(Default)
+		if err != nil {
+			t.Fatalf("json.Marshal(Default) failed: %v", err)
+		}
+		return data
+	}
+	outputs := map[string]func() []byte{
+		"handler":       func() []byte { return serve(Handler(), "/").Body.Bytes() },
+		"FlatHandler":   func() []byte { return serve(FlatHandler(Default), "/").Body.Bytes() },
+		"DiffHandler":   func() []byte { return serve(DiffHandler(Default), "/").Body.Bytes() },
+		"SchemaHandler": func() []byte { return serve(SchemaHandler(Default), "/").Body.Bytes() },
+		"MarshalJSON":   marshal,
+	}
+
+	for name, output := range outputs {
+		if !present(name, output()) {
+			t.Errorf("%s: cmdline and memstats missing before HideDefaults", name)
+		}
+	}
+
+	HideDefaults()
+	for name, output := range outputs {
+		if present(name, output()) {
+			t.Errorf("%s: cmdline or memstats present after HideDefaults", name)
+		}
+	}
+	if w := serve(Handler(), "/?var=cmdline"); w.Code != http.StatusNotFound {
+		t.Errorf("GET ?var=cmdline: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if Get("cmdline") == nil || Get("memstats") == nil {
+		t.Errorf("cmdline and memstats are no longer published after HideDefaults")
+	}
+}
+
+func TestHandlerPanickingFunc(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a").Set(3)
+	b.NewFunc("broken", func() interface{} {
+		var m map[string]int
+		m["x"] = 1
+		return m
+	})
+	b.Publish("slow", TimeoutFunc(func() interface{} {
+		panic("boom")
+	}, time.Minute))
+	b.NewInt("z").Set(4)
+
+	w := serve(HandlerFor(b), "/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.Bytes(), err)
+	}
+	if doc["a"] != 3.0 || doc["z"] != 4.0 {
+		t.Errorf("a = %v, z = %v, want 3 and 4", doc["a"], doc["z"])
+	}
+	for _, name := range []string{"broken", "slow"} {
+		obj, _ := doc[name].(map[string]interface{})
+		if _, ok := obj["panic"]; !ok {
+			t.Errorf("%s = %v, want an object holding the panic", name, doc[name])
+		}
+	}
+
+	w = serve(HandlerFor(b), "/", "Accept", "application/msgpack")
+	if w.Code != http.StatusOK {
+		t.Errorf("MessagePack: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHandlerWithLimit(t *testing.T) {
+	b := new(Bucket)
+	for i := 0; i < 100; i++ {
+		b.NewInt(fmt.Sprintf("v%03d", i)).Set(int64(i))
+	}
+
+	tests := []struct {
+		limit     int
+		truncated bool
+	}{
+		{200, true},
+		{1000, true},
+		{100000, false},
+	}
+	for _, tt := range tests {
+		w := serve(HandlerWithLimit(b, tt.limit), "/")
+		var doc map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("limit %d: invalid JSON %q: %v", tt.limit, w.Body.Bytes(), err)
+		}
+		if w.Body.Len() > tt.limit {
+			t.Errorf("limit %d: body is %d bytes", tt.limit, w.Body.Len())
+		}
+		if got := doc["_truncated"] == true; got != tt.truncated {
+			t.Errorf("limit %d: truncated = %v, want %v", tt.limit, got, tt.truncated)
+		}
+		if !tt.truncated && len(doc) != 100 {
+			t.Errorf("limit %d: %d vars, want 100", tt.limit, len(doc))
+		}
+	}
+}
+
+func TestHandlerWithLimitMap(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a").Set(1)
+	m := b.NewMap("m")
+	for i := 0; i < 100; i++ {
+		m.Add(fmt.Sprintf("k%03d", i), int64(i))
+	}
+	b.NewInt("z").Set(2)
+	h := HandlerWithLimit(b, 300)
+
+	w := serve(h, "/")
+	if w.Body.Len() > 300 {
+		t.Errorf("body is %d bytes, want at most 300", w.Body.Len())
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.Bytes(), err)
+	}
+	if doc["_truncated"] != true || doc["a"] != 1.0 || doc["z"] != nil {
+		t.Errorf("doc = %v, want a, a truncated m and _truncated", doc)
+	}
+	mdoc, _ := doc["m"].(map[string]interface{})
+	if mdoc["_truncated"] != true || mdoc["k000"] != 0.0 || len(mdoc) == 101 {
+		t.Errorf("m = %v, want its first keys and _truncated", doc["m"])
+	}
+
+	// A Map that fits is served whole.
+	if got := decodeKeys(t, serve(HandlerWithLimit(b, 100000), "/").Body.Bytes()); len(got) != 3 {
+		t.Errorf("keys with a large limit = %v, want [a m z]", got)
+	}
+
+	// A single var cannot be truncated, so one over the limit is refused.
+	if w := serve(h, "/?var=m"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("GET ?var=m: status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if w := serve(h, "/?var=m", "Accept", "application/msgpack"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("GET ?var=m as MessagePack: status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if w := serve(h, "/?var=a"); w.Code != http.StatusOK || w.Body.String() != "1" {
+		t.Errorf("GET ?var=a = %d %q, want 200 1", w.Code, w.Body.String())
+	}
+}
+
+func TestHandlerWithLimitFormats(t *testing.T) {
+	b := new(Bucket)
+	for i := 0; i < 100; i++ {
+		b.NewInt(fmt.Sprintf("v%03d", i)).Set(int64(i))
+	}
+	h := HandlerWithLimit(b, 300)
+
+	w := serve(h, "/", "Accept", "application/msgpack")
+	if w.Body.Len() > 300 {
+		t.Errorf("MessagePack body is %d bytes, want at most 300", w.Body.Len())
+	}
+	doc, _, err := decodeMsgpack(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decoding MessagePack % x: %v", w.Body.Bytes(), err)
+	}
+	if got := doc.(map[string]interface{})["_truncated"]; got != true {
+		t.Errorf("MessagePack _truncated = %v, want true", got)
+	}
+
+	w = serve(h, "/", "Accept", "text/html")
+	if w.Body.Len() > 300 {
+		t.Errorf("HTML body is %d bytes, want at most 300", w.Body.Len())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "truncated") || !strings.HasSuffix(body, "</html>\n") {
+		t.Errorf("HTML body = %q, want a complete page with a truncation note", body)
+	}
+}
+
+func TestHandlerWithLimitKeepsDelta(t *testing.T) {
+	b := new(Bucket)
+	b.NewString("a").Set(strings.Repeat("x", 100))
+	d := b.NewDeltaInt("b")
+	d.Add(5)
+
+	EnableAccessTracking()
+	defer atomic.StoreInt32(&accessTracking, 0)
+
+	w := serve(HandlerWithLimit(b, 135), "/")
+	if got := decodeKeys(t, w.Body.Bytes()); !reflect.DeepEqual(got, []string{"_truncated", "a"}) {
+		t.Fatalf("keys = %v, want [_truncated a]", got)
+	}
+	if got := d.Value(); got != 5 {
+		t.Errorf("d.Value() after being left out = %d, want 5", got)
+	}
+	if got := b.AccessCount("b"); got != 0 {
+		t.Errorf("AccessCount(%q) after being left out = %d, want 0", "b", got)
+	}
+
+	if body := serve(HandlerFor(b), "/?var=b").Body.String(); body != "5" {
+		t.Errorf("GET ?var=b = %q, want 5", body)
+	}
+}
+
+func TestHandlerSortByValue(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a").Set(2)
+	b.NewInt("b").Set(9)
+	b.NewInt("c").Set(5)
+	b.NewString("d").Set("x")
+	h := HandlerFor(b)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"sort=value&order=desc", "{\n\"b\": 9,\n\"c\": 5,\n\"a\": 2,\n\"d\": \"x\"\n}\n"},
+		{"sort=value", "{\n\"a\": 2,\n\"c\": 5,\n\"b\": 9,\n\"d\": \"x\"\n}\n"},
+		{"sort=key", "{\n\"a\": 2,\n\"b\": 9,\n\"c\": 5,\n\"d\": \"x\"\n}\n"},
+	}
+	for _, tt := range tests {
+		if got := serve(h, "/?"+tt.query).Body.String(); got != tt.want {
+			t.Errorf("GET ?%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"sort=size", "sort=value&order=up"} {
+		if w := serve(h, "/?"+query); w.Code != http.StatusBadRequest {
+			t.Errorf("GET ?%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerEscapesNames(t *testing.T) {
+	b := new(Bucket)
+	key := "a\"b\nc\x7f "
+	b.NewInt(key).Set(1)
+	b.NewMap("m").Add(key, 2)
+
+	marshaled, err := b.MarshalJSON()
+	if err != nil {
+		t.Fatalf("b.MarshalJSON: %v", err)
+	}
+	for _, body := range []string{serve(HandlerFor(b), "/").Body.String(), string(marshaled)} {
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &doc); err != nil {
+			t.Fatalf("invalid JSON %q: %v", body, err)
+		}
+		if doc[key] != 1.0 {
+			t.Errorf("%q: top-level key not decoded back, got %v", body, doc)
+		}
+		if m, _ := doc["m"].(map[string]interface{}); m[key] != 2.0 {
+			t.Errorf("%q: map key not decoded back, got %v", body, doc["m"])
+		}
+	}
+}
+
+func TestHandlerHTMLIndex(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests")
+	b.NewInt("x<y&z")
+	h := HandlerFor(b)
+
+	w := serve(h, "/", "Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	body := w.Body.String()
+	for _, anchor := range []string{
+		`<a href="?var=requests">requests</a>`,
+		`<a href="?var=x%3Cy%26z">x&lt;y&amp;z</a>`,
+	} {
+		if !strings.Contains(body, anchor) {
+			t.Errorf("body does not contain %s:\n%s", anchor, body)
+		}
+	}
+
+	// Machine clients still get JSON, as do single var requests.
+	if ct := serve(h, "/").Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("without Accept: Content-Type = %q, want JSON", ct)
+	}
+	if ct := serve(h, "/?var=requests", "Accept", "text/html").Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("single var: Content-Type = %q, want JSON", ct)
+	}
+}
+
+// failWriter accepts n writes and then fails every write after them.
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("broken pipe")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestBucketWriteTo(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(1)
+	b.NewMap("codes").Add("200", 2)
+
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo = %d, but wrote %d bytes", n, buf.Len())
+	}
+	if want := serve(HandlerFor(b), "/").Body.String(); buf.String() != want {
+		t.Errorf("WriteTo wrote %q, want the handler output %q", buf.String(), want)
+	}
+
+	if _, err := b.WriteTo(&failWriter{n: 1}); err == nil {
+		t.Error("WriteTo to a failing writer succeeded")
+	}
+}
+
+func TestBucketWriteToPeeks(t *testing.T) {
+	b := new(Bucket)
+	d := b.NewDeltaInt("delta")
+	d.Add(5)
+
+	EnableAccessTracking()
+	defer atomic.StoreInt32(&accessTracking, 0)
+
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		b.WriteTo(&buf)
+		if got, want := buf.String(), "{\n\"delta\": 5\n}\n"; got != want {
+			t.Errorf("WriteTo #%d wrote %q, want %q", i, got, want)
+		}
+	}
+	if got := d.Value(); got != 5 {
+		t.Errorf("d.Value() after WriteTo = %d, want 5", got)
+	}
+	if got := b.AccessCount("delta"); got != 0 {
+		t.Errorf("AccessCount(%q) after WriteTo = %d, want 0", "delta", got)
+	}
+}
+
+func TestHandlerWithContentType(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests")
+
+	w := serve(HandlerWithContentType(b, "application/json"), "/")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/json")
+	}
+	if got, want := decodeKeys(t, w.Body.Bytes()), []string{"requests"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+
+	if msg := panicMessage(func() { HandlerWithContentType(b, "") }); msg == "" {
+		t.Error("HandlerWithContentType with an empty content type did not panic")
+	}
+}
@@ -0,0 +1,85 @@
+package expvar
+
+import "strings"
+
+// Health is a variable that summarizes the status strings of a number of
+// components, and satisfies the Var interface. It is rendered as
+// {"overall": "healthy", "components": {"db": "healthy", ...}}.
+type Health struct {
+	components Map // map[string]*String
+}
+
+// SetStatus sets the status of component. A component is considered
+// healthy only if its status is "healthy".
+func (v *Health) SetStatus(component, status string) {
+	if sv, ok := v.components.GetString(component); ok {
+		sv.Set(status)
+		return
+	}
+	sv := new(String)
+	sv.Set(status)
+	if actual, loaded := v.components.LoadOrStore(component, sv); loaded {
+		if sv, ok := actual.(*String); ok {
+			sv.Set(status)
+		}
+	}
+}
+
+// Status returns the status of component, or the empty string if it has
+// not been set.
+func (v *Health) Status(component string) string {
+	if sv, ok := v.components.GetString(component); ok {
+		return sv.Value()
+	}
+	return ""
+}
+
+// Overall returns "healthy" if every component is healthy, and "unhealthy"
+// otherwise. A Health without components is healthy.
+func (v *Health) Overall() string {
+	overall := "healthy"
+	v.components.DoWhile(func(kv KeyValue) bool {
+		if sv, ok := kv.Value.(*String); ok && sv.Value() != "healthy" {
+			overall = "unhealthy"
+			return false
+		}
+		return true
+	})
+	return overall
+}
+
+func (v *Health) String() string {
+	var b strings.Builder
+	b.WriteString(`{"overall": `)
+	b.WriteString(quoteJSON(v.Overall()))
+	b.WriteString(`, "components": `)
+	b.WriteString(v.components.String())
+	b.WriteString("}")
+	return b.String()
+}
+
+func (v *Health) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Health) clone() Var {
+	c := new(Health)
+	v.components.Do(func(kv KeyValue) {
+		c.components.Set(kv.Key, cloneVar(kv.Value))
+	})
+	return c
+}
+
+func NewHealth(name string) *Health {
+	return Default.NewHealth(name)
+}
+
+func (m *Bucket) NewHealth(name string) *Health {
+	if v, ok := m.Get(name).(*Health); ok {
+		return v
+	}
+
+	v := new(Health)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,36 @@
+package expvar
+
+import "testing"
+
+func TestHealth(t *testing.T) {
+	v := new(Bucket).NewHealth("ready")
+	if got := v.Overall(); got != "healthy" {
+		t.Errorf("Overall() without components = %q, want healthy", got)
+	}
+
+	v.SetStatus("db", "healthy")
+	v.SetStatus("cache", "healthy")
+	if got := v.Overall(); got != "healthy" {
+		t.Errorf("Overall() with healthy components = %q, want healthy", got)
+	}
+
+	v.SetStatus("cache", "degraded")
+	if got := v.Overall(); got != "unhealthy" {
+		t.Errorf("Overall() with a degraded cache = %q, want unhealthy", got)
+	}
+	want := `{"overall": "unhealthy", "components": {"cache": "degraded", "db": "healthy"}}`
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+	if got := v.Status("cache"); got != "degraded" {
+		t.Errorf("Status(%q) = %q, want degraded", "cache", got)
+	}
+	if got := v.Status("queue"); got != "" {
+		t.Errorf("Status(%q) = %q, want empty", "queue", got)
+	}
+
+	v.SetStatus("cache", "healthy")
+	if got := v.Overall(); got != "healthy" {
+		t.Errorf("Overall() after recovery = %q, want healthy", got)
+	}
+}
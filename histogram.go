@@ -0,0 +1,131 @@
+package expvar
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Histogram is a variable counting observed values in buckets with
+// configurable upper bounds, and satisfies the Var interface. It is rendered
+// as {"count": n, "sum": s, "buckets": {"le": n, ...}}, where each bucket
+// holds the number of observations less than or equal to its bound, and
+// the "+Inf" bucket holds all observations.
+type Histogram struct {
+	bounds []float64 // sorted
+	counts []uint64  // per bucket, the last one counts values above all bounds
+	sum    uint64    // float64 bits
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	b := make([]float64, 0, len(bounds))
+	for _, bound := range bounds {
+		if math.IsNaN(bound) {
+			panic("expvar: Histogram bound must not be NaN")
+		}
+		// The +Inf bucket is always there.
+		if !math.IsInf(bound, 1) {
+			b = append(b, bound)
+		}
+	}
+	sort.Float64s(b)
+	// Drop duplicate bounds, which would render duplicate keys.
+	n := 0
+	for i, bound := range b {
+		if i == 0 || bound != b[n-1] {
+			b[n] = bound
+			n++
+		}
+	}
+	b = b[:n]
+	return &Histogram{
+		bounds: b,
+		counts: make([]uint64, len(b)+1),
+	}
+}
+
+// Observe adds value to the histogram. NaN values are ignored.
+func (v *Histogram) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+
+	atomic.AddUint64(&v.counts[sort.SearchFloat64s(v.bounds, value)], 1)
+	for {
+		cur := atomic.LoadUint64(&v.sum)
+		curVal := math.Float64frombits(cur)
+		nxtVal := curVal + value
+		nxt := math.Float64bits(nxtVal)
+		if atomic.CompareAndSwapUint64(&v.sum, cur, nxt) {
+			return
+		}
+	}
+}
+
+// Count returns the number of observed values.
+func (v *Histogram) Count() uint64 {
+	var n uint64
+	for i := range v.counts {
+		n += atomic.LoadUint64(&v.counts[i])
+	}
+	return n
+}
+
+// Sum returns the sum of all observed values.
+func (v *Histogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.sum))
+}
+
+func (v *Histogram) String() string {
+	counts := make([]uint64, len(v.counts))
+	var count uint64
+	for i := range v.counts {
+		count += atomic.LoadUint64(&v.counts[i])
+		counts[i] = count
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "{\"count\": %d, \"sum\": %s, \"buckets\": {", count, formatFloat(v.Sum()))
+	for i, bound := range v.bounds {
+		fmt.Fprintf(&b, "%q: %d, ", strconv.FormatFloat(bound, 'g', -1, 64), counts[i])
+	}
+	fmt.Fprintf(&b, "\"+Inf\": %d}}", count)
+	return b.String()
+}
+
+func (v *Histogram) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Histogram) clone() Var {
+	c := &Histogram{
+		bounds: v.bounds,
+		counts: make([]uint64, len(v.counts)),
+		sum:    atomic.LoadUint64(&v.sum),
+	}
+	for i := range v.counts {
+		c.counts[i] = atomic.LoadUint64(&v.counts[i])
+	}
+	return c
+}
+
+// NewHistogram creates and publishes a Histogram with the given bucket
+// upper bounds. The bounds are sorted if they are not in ascending order,
+// and duplicates and +Inf, whose bucket is always rendered, are dropped. It
+// panics if a bound is NaN.
+func NewHistogram(name string, bounds []float64) *Histogram {
+	return Default.NewHistogram(name, bounds)
+}
+
+func (m *Bucket) NewHistogram(name string, bounds []float64) *Histogram {
+	if v, ok := m.Get(name).(*Histogram); ok {
+		return v
+	}
+
+	v := newHistogram(bounds)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,56 @@
+package expvar
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewHistogram("latency", []float64{10, 1, 5})
+
+	for _, f := range []float64{0.5, 1, 1.5, 5, 10, 10.5, 100, math.NaN()} {
+		v.Observe(f)
+	}
+
+	if got := v.Count(); got != 7 {
+		t.Errorf("v.Count() = %d, want 7", got)
+	}
+	if got := v.Sum(); got != 128.5 {
+		t.Errorf("v.Sum() = %v, want 128.5", got)
+	}
+	// Values equal to a bound count towards its bucket, values above all
+	// bounds only towards +Inf.
+	const want = `{"count": 7, "sum": 128.5, "buckets": {"1": 2, "5": 4, "10": 5, "+Inf": 7}}`
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+}
+
+func TestHistogramOverflow(t *testing.T) {
+	v := new(Bucket).NewHistogram("latency", []float64{1})
+	v.Observe(math.Inf(1))
+	v.Observe(2)
+
+	const want = `{"count": 2, "sum": null, "buckets": {"1": 0, "+Inf": 2}}`
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+}
+
+func TestHistogramBounds(t *testing.T) {
+	v := new(Bucket).NewHistogram("latency", []float64{5, 1, math.Inf(1), 5, 1})
+	v.Observe(3)
+
+	const want = `{"count": 1, "sum": 3, "buckets": {"1": 0, "5": 1, "+Inf": 1}}`
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewHistogram with a NaN bound did not panic")
+		}
+	}()
+	new(Bucket).NewHistogram("latency", []float64{1, math.NaN()})
+}
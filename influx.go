@@ -0,0 +1,80 @@
+package expvar
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementReplacer = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxKeyReplacer   = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// InfluxLines renders the numeric variables of m as a single InfluxDB line
+// protocol point of the given measurement and tags, timestamped with the
+// current time in nanoseconds. Each var becomes a field named after it, and
+// the numeric entries of a Map become fields named name_key. Fields are
+// sorted by name; NaN and infinite values are left out, since line protocol
+// cannot represent them. It returns nil if m has no numeric vars.
+func InfluxLines(m *Bucket, measurement string, tags map[string]string) []byte {
+	fields := make(map[string]float64)
+	for _, family := range collectMetrics(m) {
+		for _, s := range family.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			name := family.Name
+			if s.Key != "" {
+				name += "_" + s.Key
+			}
+			fields[name] = s.Value
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	b.WriteString(measurementReplacer.Replace(measurement))
+	for _, k := range sortedKeys(tags) {
+		b.WriteByte(',')
+		b.WriteString(influxKeyReplacer.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(influxKeyReplacer.Replace(tags[k]))
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(influxKeyReplacer.Replace(name))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(fields[name], 'g', -1, 64))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(time.Now().UnixNano(), 10))
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
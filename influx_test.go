@@ -0,0 +1,110 @@
+package expvar
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// splitUnescaped splits s at each sep that is not escaped by a backslash.
+// The parts keep their escapes.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape removes the escaping backslashes from s.
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func TestInfluxLines(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(3)
+	b.NewFloat("load").Set(0.5)
+	b.NewFloat("nan").Set(math.NaN())
+	b.NewString("version").Set("1.0")
+	codes := b.NewMap("codes")
+	codes.Add("200", 4)
+	codes.Add("a b,c=d", 1)
+
+	before := time.Now().UnixNano()
+	line := string(InfluxLines(b, "my app", map[string]string{"host": "a,b", "dc": "x"}))
+	after := time.Now().UnixNano()
+
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("InfluxLines() = %q, want a single line", line)
+	}
+	parts := splitUnescaped(strings.TrimSuffix(line, "\n"), ' ')
+	if len(parts) != 3 {
+		t.Fatalf("InfluxLines() = %q, want measurement, fields and timestamp", line)
+	}
+
+	var series []string
+	for _, s := range splitUnescaped(parts[0], ',') {
+		series = append(series, unescape(s))
+	}
+	if want := []string{"my app", "dc=x", "host=a,b"}; !reflect.DeepEqual(series, want) {
+		t.Errorf("measurement and tags = %q, want %q", series, want)
+	}
+
+	fields := make(map[string]float64)
+	var names []string
+	for _, f := range splitUnescaped(parts[1], ',') {
+		kv := splitUnescaped(f, '=')
+		if len(kv) != 2 {
+			t.Fatalf("field %q, want key=value", f)
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			t.Fatalf("field %q: %v", f, err)
+		}
+		name := unescape(kv[0])
+		fields[name] = v
+		names = append(names, name)
+	}
+	want := map[string]float64{
+		"codes_200":     4,
+		"codes_a b,c=d": 1,
+		"load":          0.5,
+		"requests":      3,
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	if want := []string{"codes_200", "codes_a b,c=d", "load", "requests"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("field order = %q, want %q", names, want)
+	}
+
+	if ts, err := strconv.ParseInt(parts[2], 10, 64); err != nil || ts < before || ts > after {
+		t.Errorf("timestamp = %q, want between %d and %d", parts[2], before, after)
+	}
+}
+
+func TestInfluxLinesEmpty(t *testing.T) {
+	b := new(Bucket)
+	b.NewString("version")
+	if line := InfluxLines(b, "app", nil); line != nil {
+		t.Errorf("InfluxLines() without numeric vars = %q, want nil", line)
+	}
+}
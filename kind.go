@@ -0,0 +1,81 @@
+package expvar
+
+import "fmt"
+
+// VarKind is the kind of values a typed Map accepts.
+type VarKind int
+
+const (
+	// KindAny accepts values of any type. It is the kind of an untyped Map.
+	KindAny VarKind = iota
+	KindInt
+	KindFloat
+	KindString
+	KindBool
+	KindCounter
+	KindGauge
+	KindMap
+)
+
+var kindNames = [...]string{
+	KindAny:     "any",
+	KindInt:     "*Int",
+	KindFloat:   "*Float",
+	KindString:  "*String",
+	KindBool:    "*Bool",
+	KindCounter: "*Counter",
+	KindGauge:   "*Gauge",
+	KindMap:     "*Map",
+}
+
+func (k VarKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// accepts reports whether v is of kind k.
+func (k VarKind) accepts(v Var) bool {
+	switch v.(type) {
+	case *Int:
+		return k == KindAny || k == KindInt
+	case *Float:
+		return k == KindAny || k == KindFloat
+	case *String:
+		return k == KindAny || k == KindString
+	case *Bool:
+		return k == KindAny || k == KindBool
+	case *Counter:
+		return k == KindAny || k == KindCounter
+	case *Gauge:
+		return k == KindAny || k == KindGauge
+	case *Map:
+		return k == KindAny || k == KindMap
+	}
+	return k == KindAny
+}
+
+// NewTypedMap creates and publishes a Map that only accepts values of the
+// given kind. Setting a value of another type panics, and Add, AddInt and
+// AddFloat only create new entries if they match the kind. It panics if
+// kind is not a known VarKind, or if name holds a Map of another kind.
+func NewTypedMap(name string, kind VarKind) *Map {
+	return Default.NewTypedMap(name, kind)
+}
+
+func (m *Bucket) NewTypedMap(name string, kind VarKind) *Map {
+	if kind < 0 || int(kind) >= len(kindNames) {
+		panic("expvar: unknown VarKind")
+	}
+	if v, ok := m.Get(name).(*Map); ok {
+		if v.kind != kind {
+			panic(fmt.Sprintf("expvar: Map %q holds %v values, not %v", name, v.kind, kind))
+		}
+		return v
+	}
+
+	v := &Map{kind: kind}
+	m.publishNew(name, v)
+	return v
+}
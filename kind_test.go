@@ -0,0 +1,69 @@
+package expvar
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTypedMap(t *testing.T) {
+	m := new(Bucket).NewTypedMap("hits", KindInt)
+	m.Set("a", new(Int))
+	m.Add("b", 2)
+	m.AddFloat("c", 1) // no *Float entry is created in a map of *Int
+
+	if got, want := m.String(), `{"a": 0, "b": 2}`; got != want {
+		t.Errorf("m.String() = %s, want %s", got, want)
+	}
+	if got := m.Clone().kind; got != KindInt {
+		t.Errorf("m.Clone().kind = %v, want %v", got, KindInt)
+	}
+
+	msg := panicMessage(func() { m.Set("x", new(Float)) })
+	if !strings.Contains(msg, "*expvar.Float var in map of *Int for key: x") {
+		t.Errorf("Set of a *Float panicked with %q, want a message naming the kinds and key", msg)
+	}
+	if m.Get("x") != nil {
+		t.Error("rejected value was stored")
+	}
+}
+
+func TestTypedMapKindMismatch(t *testing.T) {
+	b := new(Bucket)
+	m := b.NewTypedMap("hits", KindInt)
+	if got := b.NewTypedMap("hits", KindInt); got != m {
+		t.Errorf("NewTypedMap of the same kind returned another Map")
+	}
+
+	for _, kind := range []VarKind{KindFloat, KindAny} {
+		msg := panicMessage(func() { b.NewTypedMap("hits", kind) })
+		if want := fmt.Sprintf(`expvar: Map "hits" holds *Int values, not %v`, kind); msg != want {
+			t.Errorf("NewTypedMap(%v) of a map of *Int panicked with %q, want %q", kind, msg, want)
+		}
+	}
+}
+
+func TestVarKindAccepts(t *testing.T) {
+	tests := []struct {
+		kind VarKind
+		v    Var
+		want bool
+	}{
+		{KindAny, new(Float), true},
+		{KindAny, Func(func() interface{} { return nil }), true},
+		{KindInt, new(Int), true},
+		{KindInt, new(Counter), false},
+		{KindFloat, new(Float), true},
+		{KindString, new(Int), false},
+		{KindMap, new(Map), true},
+		{KindGauge, Func(func() interface{} { return nil }), false},
+	}
+	for _, tt := range tests {
+		if got := tt.kind.accepts(tt.v); got != tt.want {
+			t.Errorf("%v.accepts(%T) = %v, want %v", tt.kind, tt.v, got, tt.want)
+		}
+	}
+	if got := VarKind(100).String(); got != "unknown" {
+		t.Errorf("VarKind(100).String() = %q, want unknown", got)
+	}
+}
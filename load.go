@@ -0,0 +1,67 @@
+package expvar
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Load reads a JSON object, such as one served by the handler, and returns
+// a new Bucket with a variable published for each of its members. The types
+// of the variables are inferred from the JSON values: integral numbers
+// become an Int, other numbers a Float, strings a String, booleans a Bool
+// and objects a Map, recursively. Other values, such as arrays and null,
+// become a Func returning the decoded value.
+func Load(r io.Reader) (*Bucket, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errors.New("expvar: snapshot is not a JSON object")
+	}
+
+	m := new(Bucket)
+	for name, val := range doc {
+		if err := m.TryPublish(name, loadVar(val)); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// loadVar returns a Var holding the decoded JSON value val.
+func loadVar(val interface{}) Var {
+	switch val := val.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			v := new(Int)
+			v.Set(i)
+			return v
+		}
+		f, _ := val.Float64()
+		v := new(Float)
+		v.Set(f)
+		return v
+	case string:
+		v := new(String)
+		v.Set(val)
+		return v
+	case bool:
+		v := new(Bool)
+		v.Set(val)
+		return v
+	case map[string]interface{}:
+		v := new(Map)
+		for key, child := range val {
+			v.Set(key, loadVar(child))
+		}
+		return v
+	}
+	return Func(func() interface{} {
+		return val
+	})
+}
@@ -0,0 +1,49 @@
+package expvar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadRoundTrip(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests").Set(42)
+	b.NewFloat("ratio").Set(0.25)
+	b.NewString("version").Set("1.2.3")
+	b.NewBool("ready").Set(true)
+	m := b.NewMap("codes")
+	m.Add("200", 7)
+	m.AddFloat("latency", 1.5)
+
+	want := serve(HandlerFor(b), "/").Body.String()
+	loaded, err := Load(strings.NewReader(want))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := serve(HandlerFor(loaded), "/").Body.String(); got != want {
+		t.Errorf("reloaded document = %s, want %s", got, want)
+	}
+
+	if _, ok := loaded.Get("requests").(*Int); !ok {
+		t.Errorf("requests loaded as %T, want *Int", loaded.Get("requests"))
+	}
+	if _, ok := loaded.Get("ratio").(*Float); !ok {
+		t.Errorf("ratio loaded as %T, want *Float", loaded.Get("ratio"))
+	}
+	lm, ok := loaded.Get("codes").(*Map)
+	if !ok {
+		t.Fatalf("codes loaded as %T, want *Map", loaded.Get("codes"))
+	}
+	if got, want := lm.Keys(), []string{"200", "latency"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("codes keys = %v, want %v", got, want)
+	}
+}
+
+func TestLoadNotAnObject(t *testing.T) {
+	for _, doc := range []string{"null", "[1, 2]", "{"} {
+		if _, err := Load(strings.NewReader(doc)); err == nil {
+			t.Errorf("Load(%q) succeeded, want an error", doc)
+		}
+	}
+}
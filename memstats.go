@@ -0,0 +1,111 @@
+package expvar
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memStatsTTL is how long a read of the memory statistics is shared by the
+// MemStatsField vars.
+const memStatsTTL = time.Second
+
+// readMemStats reads the memory statistics. It is a variable so tests can
+// count the reads.
+var readMemStats = runtime.ReadMemStats
+
+// memStatsCache holds the last read of the memory statistics, so that a
+// scrape of several MemStatsField vars stops the world only once.
+var memStatsCache struct {
+	mu    sync.Mutex
+	stats runtime.MemStats
+	read  time.Time
+}
+
+// cachedMemStats returns the memory statistics, reading them if the last
+// read is older than memStatsTTL.
+func cachedMemStats() runtime.MemStats {
+	memStatsCache.mu.Lock()
+	defer memStatsCache.mu.Unlock()
+	if now := time.Now(); now.Sub(memStatsCache.read) >= memStatsTTL {
+		readMemStats(&memStatsCache.stats)
+		memStatsCache.read = now
+	}
+	return memStatsCache.stats
+}
+
+// MemStatsField is a variable exposing a single field of
+// runtime.MemStats, and satisfies the Var interface. The statistics are
+// read at most once per second and shared by all MemStatsField vars.
+type MemStatsField struct {
+	index int // field index in runtime.MemStats
+}
+
+func newMemStatsField(field string) *MemStatsField {
+	f, ok := reflect.TypeOf(runtime.MemStats{}).FieldByName(field)
+	if !ok {
+		panic("expvar: unknown MemStats field " + field)
+	}
+	switch f.Type.Kind() {
+	case reflect.Uint64, reflect.Uint32, reflect.Float64, reflect.Bool:
+	default:
+		panic("expvar: MemStats field " + field + " is not a scalar")
+	}
+	return &MemStatsField{index: f.Index[0]}
+}
+
+func (v *MemStatsField) String() string {
+	stats := cachedMemStats()
+	f := reflect.ValueOf(stats).Field(v.index)
+	switch f.Kind() {
+	case reflect.Float64:
+		return formatFloat(f.Float())
+	case reflect.Bool:
+		return strconv.FormatBool(f.Bool())
+	}
+	return strconv.FormatUint(f.Uint(), 10)
+}
+
+// NumericValue returns the value of the field as a float64. A bool field is
+// 1 if it is true and 0 otherwise.
+func (v *MemStatsField) NumericValue() float64 {
+	f := reflect.ValueOf(cachedMemStats()).Field(v.index)
+	switch f.Kind() {
+	case reflect.Float64:
+		return f.Float()
+	case reflect.Bool:
+		if f.Bool() {
+			return 1
+		}
+		return 0
+	}
+	return float64(f.Uint())
+}
+
+func (v *MemStatsField) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// NewMemStatsField creates and publishes a var exposing the field of
+// runtime.MemStats with the given name, such as "HeapAlloc". It panics if
+// there is no such field or it is not a number or bool, or if name already
+// exposes another field.
+func NewMemStatsField(name, field string) Var {
+	return Default.NewMemStatsField(name, field)
+}
+
+func (m *Bucket) NewMemStatsField(name, field string) Var {
+	v := newMemStatsField(field)
+	if have, ok := m.Get(name).(*MemStatsField); ok {
+		if have.index != v.index {
+			panic("expvar: MemStatsField " + strconv.Quote(name) + " exposes " +
+				reflect.TypeOf(runtime.MemStats{}).Field(have.index).Name + ", not " + field)
+		}
+		return have
+	}
+
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,66 @@
+package expvar
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMemStatsFieldSharesRead(t *testing.T) {
+	reads := 0
+	read := readMemStats
+	defer func() { readMemStats = read }()
+	readMemStats = func(m *runtime.MemStats) {
+		reads++
+		read(m)
+	}
+	memStatsCache.mu.Lock()
+	memStatsCache.read = time.Time{}
+	memStatsCache.mu.Unlock()
+
+	b := new(Bucket)
+	b.NewMemStatsField("heap", "HeapAlloc")
+	b.NewMemStatsField("gc", "NumGC")
+	b.NewMemStatsField("gc_cpu", "GCCPUFraction")
+	b.NewMemStatsField("gc_enabled", "EnableGC")
+
+	w := serve(HandlerFor(b), "/")
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.Bytes(), err)
+	}
+	if reads != 1 {
+		t.Errorf("ReadMemStats called %d times for one scrape, want 1", reads)
+	}
+	if heap, _ := doc["heap"].(float64); heap <= 0 {
+		t.Errorf("heap = %v, want a positive number", doc["heap"])
+	}
+	if doc["gc_enabled"] != true {
+		t.Errorf("gc_enabled = %v, want true", doc["gc_enabled"])
+	}
+}
+
+func TestNewMemStatsFieldInvalid(t *testing.T) {
+	b := new(Bucket)
+	for _, field := range []string{"NoSuchField", "PauseNs", "BySize"} {
+		if msg := panicMessage(func() { b.NewMemStatsField("x", field) }); msg == "" {
+			t.Errorf("NewMemStatsField(%q) did not panic", field)
+		}
+	}
+	if b.Get("x") != nil {
+		t.Error("invalid field was published")
+	}
+}
+
+func TestNewMemStatsFieldMismatch(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewMemStatsField("heap", "HeapAlloc")
+	if got := b.NewMemStatsField("heap", "HeapAlloc"); got != v {
+		t.Errorf("NewMemStatsField of the same field returned another var")
+	}
+	msg := panicMessage(func() { b.NewMemStatsField("heap", "NumGC") })
+	if want := `expvar: MemStatsField "heap" exposes HeapAlloc, not NumGC`; msg != want {
+		t.Errorf("NewMemStatsField of another field panicked with %q, want %q", msg, want)
+	}
+}
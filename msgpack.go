@@ -0,0 +1,120 @@
+package expvar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// appendMsgpack appends the MessagePack encoding of v to b. It supports the
+// types of the values returned by Snapshot: nil, bool, signed and unsigned
+// integers, float64, string, time.Duration and time.Time (both encoded as
+// strings, like their JSON forms), []interface{} and
+// map[string]interface{}. Map keys are encoded in sorted order.
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendMsgpackInt(b, int64(v)), nil
+	case int64:
+		return appendMsgpackInt(b, v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendMsgpackInt(b, int64(v)), nil
+		}
+		b = append(b, 0xcf)
+		return appendUint64(b, v), nil
+	case float64:
+		b = append(b, 0xcb)
+		return appendUint64(b, math.Float64bits(v)), nil
+	case string:
+		return appendMsgpackString(b, v), nil
+	case time.Duration:
+		return appendMsgpackString(b, v.String()), nil
+	case time.Time:
+		return appendMsgpackString(b, v.Format(time.RFC3339Nano)), nil
+	case []interface{}:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc, 0xdd)
+		for _, e := range v {
+			var err error
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = appendMsgpackHeader(b, len(v), 0x80, 0xde, 0xdf)
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			var err error
+			if b, err = appendMsgpack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("expvar: cannot encode %T as MessagePack", v)
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	if i >= -32 && i <= 127 {
+		// positive or negative fixint
+		return append(b, byte(i))
+	}
+	b = append(b, 0xd3)
+	return appendUint64(b, uint64(i))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb)
+		b = appendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackHeader appends an array or map header for n elements, using
+// the fix, 16-bit or 32-bit form.
+func appendMsgpackHeader(b []byte, n int, fix, b16, b32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, b16, byte(n>>8), byte(n))
+	}
+	b = append(b, b32)
+	return appendUint32(b, uint32(n))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,169 @@
+package expvar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// decodeMsgpack decodes the first MessagePack value in b, supporting the
+// formats written by appendMsgpack, and returns it with the remaining bytes.
+// Integers decode as int64, maps as map[string]interface{}.
+func decodeMsgpack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of input")
+	}
+	c, b := b[0], b[1:]
+	need := func(n int) error {
+		if len(b) < n {
+			return fmt.Errorf("unexpected end of input")
+		}
+		return nil
+	}
+
+	var n int
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+		if err := need(n); err != nil {
+			return nil, nil, err
+		}
+		return string(b[:n]), b[n:], nil
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(b, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(b, int(c&0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2, 0xc3:
+		return c == 0xc3, b, nil
+	case 0xcb, 0xd3, 0xcf:
+		if err := need(8); err != nil {
+			return nil, nil, err
+		}
+		u := binary.BigEndian.Uint64(b)
+		switch c {
+		case 0xcb:
+			return math.Float64frombits(u), b[8:], nil
+		case 0xd3:
+			return int64(u), b[8:], nil
+		}
+		return u, b[8:], nil
+	case 0xd9, 0xda, 0xdb, 0xdc, 0xdd, 0xde, 0xdf:
+		size := map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4, 0xdc: 2, 0xdd: 4, 0xde: 2, 0xdf: 4}[c]
+		if err := need(size); err != nil {
+			return nil, nil, err
+		}
+		for _, x := range b[:size] {
+			n = n<<8 | int(x)
+		}
+		b = b[size:]
+		switch c {
+		case 0xdc, 0xdd:
+			return decodeMsgpackArray(b, n)
+		case 0xde, 0xdf:
+			return decodeMsgpackMap(b, n)
+		}
+		if err := need(n); err != nil {
+			return nil, nil, err
+		}
+		return string(b[:n]), b[n:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported format byte %#x", c)
+}
+
+func decodeMsgpackArray(b []byte, n int) (interface{}, []byte, error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		var err error
+		if a[i], b, err = decodeMsgpack(b); err != nil {
+			return nil, nil, err
+		}
+	}
+	return a, b, nil
+}
+
+func decodeMsgpackMap(b []byte, n int) (interface{}, []byte, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("map key %v is not a string", k)
+		}
+		if m[key], b, err = decodeMsgpack(rest); err != nil {
+			return nil, nil, err
+		}
+	}
+	return m, b, nil
+}
+
+func TestHandlerMsgpack(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("int").Set(300)
+	b.NewInt("negative").Set(-5)
+	b.NewFloat("float").Set(1.5)
+	b.NewString("string").Set("hi")
+	b.NewMap("map").Add("a", 1)
+
+	w := serve(HandlerFor(b), "/", "Accept", "application/msgpack")
+	if ct := w.Header().Get("Content-Type"); ct != "application/msgpack" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/msgpack")
+	}
+	got, rest, err := decodeMsgpack(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decoding % x: %v", w.Body.Bytes(), err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("%d trailing bytes after the document", len(rest))
+	}
+	want := map[string]interface{}{
+		"int":      int64(300),
+		"negative": int64(-5),
+		"float":    1.5,
+		"string":   "hi",
+		"map":      map[string]interface{}{"a": int64(1)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %#v, want %#v", got, want)
+	}
+
+	// Without the Accept header JSON is served.
+	w = serve(HandlerFor(b), "/")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type without Accept = %q, want JSON", ct)
+	}
+}
+
+func TestAppendMsgpackLengths(t *testing.T) {
+	long := string(make([]byte, 300))
+	list := make([]interface{}, 20)
+	for i := range list {
+		list[i] = int64(i)
+	}
+	for _, v := range []interface{}{long, list, true, nil, int64(math.MinInt64), uint64(math.MaxUint64)} {
+		b, err := appendMsgpack(nil, v)
+		if err != nil {
+			t.Fatalf("appendMsgpack(%T): %v", v, err)
+		}
+		got, _, err := decodeMsgpack(b)
+		if err != nil {
+			t.Fatalf("decoding %T: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip of %T = %v, want %v", v, got, v)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package expvar
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// OpenMetricsHandler returns an HTTP Handler that serves the numeric
+// variables of m in the OpenMetrics text format. Vars are flattened the same
+// way as by PrometheusHandler; Counter vars are exported as counters with a
+// _total suffix. The original var name is used as the help text. Like
+// for PrometheusHandler, a var whose metric or sample name is already used
+// by a var earlier in name order is skipped.
+func OpenMetricsHandler(m *Bucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		seen := make(map[string]bool)
+		for _, family := range collectMetrics(m) {
+			name := metricName(family.Name)
+			sampleName := name
+			if family.Type == "counter" {
+				name = strings.TrimSuffix(name, "_total")
+				sampleName = name + "_total"
+			}
+			if seen[name] || seen[sampleName] {
+				continue
+			}
+			seen[name] = true
+			seen[sampleName] = true
+
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, family.Type)
+			fmt.Fprintf(w, "# HELP %s %s\n", name, helpReplacer.Replace(family.Name))
+			for _, s := range family.Samples {
+				writeSample(w, sampleName, s)
+			}
+		}
+		fmt.Fprintf(w, "# EOF\n")
+	})
+}
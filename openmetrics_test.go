@@ -0,0 +1,35 @@
+package expvar
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenMetricsHandler(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("http.requests").Set(3)
+	b.NewFloat("load").Set(0.5)
+	b.NewString("version").Set("1.0")
+	b.NewCounter("jobs").Add(7)
+	b.NewCounter("errors_total").Add(2)
+	codes := b.NewMap("codes")
+	codes.Add("200", 4)
+	codes.Add(`5"0`, 1)
+	// Collides with the samples of the jobs counter, and is skipped.
+	b.NewInt("jobs.total").Set(1)
+
+	w := serve(OpenMetricsHandler(b), "/")
+	if ct, want := w.Header().Get("Content-Type"), "application/openmetrics-text; version=1.0.0; charset=utf-8"; ct != want {
+		t.Errorf("Content-Type = %q, want %q", ct, want)
+	}
+
+	golden := filepath.Join("testdata", "openmetrics.txt")
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading %s failed: %v", golden, err)
+	}
+	if got := w.Body.String(); got != string(want) {
+		t.Errorf("body =\n%s\nwant (%s)\n%s", got, golden, want)
+	}
+}
@@ -0,0 +1,91 @@
+package expvar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ApplyPatch applies a JSON merge patch to the variables of m. The patch
+// must be an object whose members name writable variables: an Int, Float
+// or Gauge takes a number, a String a string and a Bool a boolean. If any
+// member names an unknown variable, one of another type such as a Func or
+// Map, or holds a value of the wrong type, an error describing it is
+// returned and no variable is changed.
+func (m *Bucket) ApplyPatch(patch []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	if doc == nil {
+		return errors.New("expvar: patch is not a JSON object")
+	}
+
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sets := make([]func(), 0, len(names))
+	for _, name := range names {
+		set, err := patchVar(m.Get(name), doc[name])
+		if err != nil {
+			return fmt.Errorf("expvar: patch of %q: %w", name, err)
+		}
+		sets = append(sets, set)
+	}
+	for _, set := range sets {
+		set()
+	}
+	return nil
+}
+
+// patchVar returns a function setting v to the decoded JSON value val, or
+// an error if v cannot be set to val.
+func patchVar(v Var, val interface{}) (func(), error) {
+	if v == nil {
+		return nil, errors.New("unknown var")
+	}
+
+	n, isNumber := val.(json.Number)
+	switch v := v.(type) {
+	case *Int:
+		if isNumber {
+			if i, err := n.Int64(); err == nil {
+				return func() { v.Set(i) }, nil
+			}
+		}
+		return nil, errors.New("value is not an integer")
+	case *Float:
+		if isNumber {
+			if f, err := n.Float64(); err == nil {
+				return func() { v.Set(f) }, nil
+			}
+		}
+		return nil, errors.New("value is not a number")
+	case *Gauge:
+		if isNumber {
+			if f, err := n.Float64(); err == nil {
+				return func() { v.Set(f) }, nil
+			}
+		}
+		return nil, errors.New("value is not a number")
+	case *String:
+		if s, ok := val.(string); ok {
+			return func() { v.Set(s) }, nil
+		}
+		return nil, errors.New("value is not a string")
+	case *Bool:
+		if b, ok := val.(bool); ok {
+			return func() { v.Set(b) }, nil
+		}
+		return nil, errors.New("value is not a boolean")
+	}
+	return nil, fmt.Errorf("%T is not writable", v)
+}
@@ -0,0 +1,53 @@
+package expvar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBucketApplyPatch(t *testing.T) {
+	b := new(Bucket)
+	i := b.NewInt("requests")
+	s := b.NewString("version")
+	f := b.NewFloat("ratio")
+	ok := b.NewBool("ready")
+	b.NewFunc("now", func() interface{} { return 1 })
+
+	if err := b.ApplyPatch([]byte(`{"requests": 42, "version": "1.2", "ratio": 0.5, "ready": true}`)); err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if i.Value() != 42 || s.Value() != "1.2" || f.Value() != 0.5 || !ok.Value() {
+		t.Errorf("after the patch: requests = %d, version = %q, ratio = %v, ready = %v",
+			i.Value(), s.Value(), f.Value(), ok.Value())
+	}
+
+	// A rejected patch changes nothing, not even its valid members.
+	err := b.ApplyPatch([]byte(`{"requests": 1, "now": 3}`))
+	if err == nil || !strings.Contains(err.Error(), `"now"`) || !strings.Contains(err.Error(), "Func is not writable") {
+		t.Errorf("patching a Func: err = %v, want an error naming the Func", err)
+	}
+	if got := i.Value(); got != 42 {
+		t.Errorf("requests after a rejected patch = %d, want 42", got)
+	}
+}
+
+func TestBucketApplyPatchInvalid(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("requests")
+	b.NewString("version")
+	b.NewMap("codes")
+
+	for _, patch := range []string{
+		`{"missing": 1}`,
+		`{"requests": 1.5}`,
+		`{"version": 1}`,
+		`{"codes": {}}`,
+		`[1]`,
+		`null`,
+		`{`,
+	} {
+		if err := b.ApplyPatch([]byte(patch)); err == nil {
+			t.Errorf("ApplyPatch(%s) succeeded, want an error", patch)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package expvar
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// metricSample is a single numeric value of a metric family. Key is the
+// Map key the value was stored under, or empty for top-level vars.
+type metricSample struct {
+	Key   string
+	Value float64
+}
+
+// metricFamily is a named group of numeric samples of a single type.
+type metricFamily struct {
+	Name    string
+	Type    string // "gauge" or "counter"
+	Samples []metricSample
+}
+
+// numericValue returns the value and metric type of v if it implements
+// Numeric. Counters are reported as counters, everything else as gauges.
+func numericValue(v Var) (float64, string, bool) {
+	f, ok := AsFloat(v)
+	if !ok {
+		return 0, "", false
+	}
+	if _, ok := v.(*Counter); ok {
+		return f, "counter", true
+	}
+	return f, "gauge", true
+}
+
+// collectMetrics flattens the numeric vars of m into metric families. The
+// numeric entries of a Map become the samples of a single gauge family,
+// keyed by their map key. Vars without a numeric value are skipped. Family
+// names are the unmodified var names.
+func collectMetrics(m *Bucket) []metricFamily {
+	var families []metricFamily
+	m.doVisible(func(kv KeyValue) {
+		if mv, ok := kv.Value.(*Map); ok {
+			family := metricFamily{Name: kv.Key, Type: "gauge"}
+			mv.Do(func(kv KeyValue) {
+				if f, _, ok := numericValue(kv.Value); ok {
+					family.Samples = append(family.Samples, metricSample{kv.Key, f})
+				}
+			})
+			if len(family.Samples) > 0 {
+				families = append(families, family)
+			}
+			return
+		}
+
+		if f, typ, ok := numericValue(kv.Value); ok {
+			families = append(families, metricFamily{
+				Name:    kv.Key,
+				Type:    typ,
+				Samples: []metricSample{{Value: f}},
+			})
+		}
+	})
+	return families
+}
+
+// metricName replaces all characters of name that are not valid in a
+// Prometheus metric name with underscores.
+func metricName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatMetricValue formats f as a Prometheus sample value.
+func formatMetricValue(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeSample writes a single sample line for the metric name.
+func writeSample(w io.Writer, name string, s metricSample) {
+	if s.Key != "" {
+		fmt.Fprintf(w, "%s{key=\"%s\"} %s\n", name, labelValueReplacer.Replace(s.Key), formatMetricValue(s.Value))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatMetricValue(s.Value))
+}
+
+// PrometheusHandler returns an HTTP Handler that serves the numeric
+// variables of m in the Prometheus text exposition format. Counters are
+// exported as counters and all other Numeric vars as gauges, and the
+// numeric entries of a Map as a gauge with a key label. All other vars are
+// skipped. Since invalid characters are replaced by underscores, distinct
+// var names such as "a.b" and "a_b" can map to the same metric name; only
+// the first of them in name order is exported.
+func PrometheusHandler(m *Bucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		seen := make(map[string]bool)
+		for _, family := range collectMetrics(m) {
+			name := metricName(family.Name)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, family.Type)
+			for _, s := range family.Samples {
+				writeSample(w, name, s)
+			}
+		}
+	})
+}
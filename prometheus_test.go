@@ -0,0 +1,52 @@
+package expvar
+
+import (
+	"testing"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("http.requests").Set(3)
+	b.NewFloat("load").Set(0.5)
+	b.NewString("version").Set("1.0")
+	b.NewCounter("jobs").Add(7)
+	codes := b.NewMap("codes")
+	codes.Add("200", 4)
+	codes.Add(`5"0`, 1)
+	codes.Set("name", new(String))
+
+	w := serve(PrometheusHandler(b), "/")
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("Content-Type = %q, want %q", ct, "text/plain; version=0.0.4")
+	}
+
+	const want = `# TYPE codes gauge
+codes{key="200"} 4
+codes{key="5\"0"} 1
+# TYPE http_requests gauge
+http_requests 3
+# TYPE jobs counter
+jobs 7
+# TYPE load gauge
+load 0.5
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrometheusHandlerNameCollision(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("a.b").Set(1)
+	b.NewInt("a_b").Set(2)
+	b.NewInt("a:b").Set(3)
+
+	const want = `# TYPE a_b gauge
+a_b 1
+# TYPE a:b gauge
+a:b 3
+`
+	if got := serve(PrometheusHandler(b), "/").Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
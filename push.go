@@ -0,0 +1,86 @@
+package expvar
+
+import (
+	"math/rand"
+	"time"
+)
+
+// PushOption configures the schedule of a push exporter such as PushStatsD.
+type PushOption func(*pushSchedule)
+
+// WithJitter delays every push by a random duration of up to fraction times
+// the interval, so that instances started together do not push in sync.
+func WithJitter(fraction float64) PushOption {
+	return func(s *pushSchedule) {
+		s.jitter = fraction
+	}
+}
+
+// WithBackoff makes a pusher back off exponentially after failed pushes,
+// doubling the interval after every consecutive failure up to max. The
+// delay never drops below the interval, even if max is smaller. The
+// interval is restored after the first successful push.
+func WithBackoff(max time.Duration) PushOption {
+	return func(s *pushSchedule) {
+		s.maxBackoff = max
+	}
+}
+
+// WithRandSource sets the source of randomness for the jitter, which
+// defaults to one seeded with the current time.
+func WithRandSource(src rand.Source) PushOption {
+	return func(s *pushSchedule) {
+		s.rand = rand.New(src)
+	}
+}
+
+// pushSchedule computes the delays between the pushes of a push exporter.
+// It is not safe for concurrent use.
+type pushSchedule struct {
+	interval   time.Duration
+	jitter     float64
+	maxBackoff time.Duration
+	rand       *rand.Rand
+
+	failures uint
+}
+
+func newPushSchedule(interval time.Duration, opts []PushOption) *pushSchedule {
+	if interval <= 0 {
+		panic("expvar: push interval must be positive")
+	}
+	s := &pushSchedule{interval: interval}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.rand == nil {
+		s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s
+}
+
+// next returns the delay until the next push, given the error of the last
+// push.
+func (s *pushSchedule) next(err error) time.Duration {
+	d := s.interval
+	if err == nil || s.maxBackoff <= 0 {
+		s.failures = 0
+	} else {
+		limit := s.maxBackoff
+		if limit < s.interval {
+			limit = s.interval
+		}
+		s.failures++
+		for i := uint(0); i < s.failures && d < limit; i++ {
+			d *= 2
+		}
+		if d > limit {
+			d = limit
+		}
+	}
+
+	if s.jitter > 0 {
+		d += time.Duration(s.rand.Float64() * s.jitter * float64(s.interval))
+	}
+	return d
+}
@@ -0,0 +1,76 @@
+package expvar
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPushScheduleJitter(t *testing.T) {
+	s := newPushSchedule(time.Second, []PushOption{
+		WithJitter(0.5),
+		WithRandSource(rand.NewSource(1)),
+	})
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		d := s.next(nil)
+		if d < time.Second || d > 1500*time.Millisecond {
+			t.Fatalf("next() = %v, want between 1s and 1.5s", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("next() returned the same delay every time: %v", seen)
+	}
+}
+
+func TestPushScheduleBackoff(t *testing.T) {
+	s := newPushSchedule(time.Second, []PushOption{WithBackoff(5 * time.Second)})
+
+	errPush := errors.New("connection refused")
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if d := s.next(errPush); d != w {
+			t.Errorf("next(err) after %d failures = %v, want %v", i+1, d, w)
+		}
+	}
+	if d := s.next(nil); d != time.Second {
+		t.Errorf("next(nil) after recovery = %v, want %v", d, time.Second)
+	}
+}
+
+func TestPushScheduleBackoffBelowInterval(t *testing.T) {
+	s := newPushSchedule(10*time.Second, []PushOption{WithBackoff(time.Second)})
+	for i := 0; i < 3; i++ {
+		if d := s.next(errors.New("timeout")); d != 10*time.Second {
+			t.Errorf("next(err) = %v, want the interval %v", d, 10*time.Second)
+		}
+	}
+}
+
+func TestPushInvalidInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		push func() error
+	}{
+		{"PushGraphite", func() error {
+			return PushGraphite(context.Background(), new(Bucket), "localhost:2003", "", 0)
+		}},
+		{"PushStatsD", func() error {
+			return PushStatsD(context.Background(), new(Bucket), "localhost:8125", -time.Second, "")
+		}},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s with a non-positive interval did not panic", tt.name)
+				}
+			}()
+			tt.push()
+		}()
+	}
+}
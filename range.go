@@ -0,0 +1,104 @@
+package expvar
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+// Range is a variable tracking the smallest and largest value observed,
+// and satisfies the Var interface. It is rendered as
+// {"min": -1, "max": 3, "count": 5}, with null bounds before the first
+// observation. The zero value is ready to use.
+type Range struct {
+	min   uint64 // rangeBits of the smallest value
+	max   uint64 // rangeBits of the largest value
+	count uint64
+}
+
+// rangeNaN are the float64 bits of NaN. The bounds of a Range are stored
+// xored with them, so that the zero value holds NaN bounds.
+var rangeNaN = math.Float64bits(math.NaN())
+
+func rangeBits(f float64) uint64 {
+	return math.Float64bits(f) ^ rangeNaN
+}
+
+func rangeFloat(bits uint64) float64 {
+	return math.Float64frombits(bits ^ rangeNaN)
+}
+
+func newRange() *Range {
+	return new(Range)
+}
+
+// Observe updates the bounds with value. NaN values are ignored.
+func (v *Range) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	observeBound(&v.min, value, func(cur float64) bool { return value < cur })
+	observeBound(&v.max, value, func(cur float64) bool { return value > cur })
+	atomic.AddUint64(&v.count, 1)
+}
+
+// observeBound stores value in the bound at addr if none is stored yet or
+// replace reports that value goes beyond the current one.
+func observeBound(addr *uint64, value float64, replace func(cur float64) bool) {
+	for {
+		cur := atomic.LoadUint64(addr)
+		if f := rangeFloat(cur); !math.IsNaN(f) && !replace(f) {
+			return
+		}
+		if atomic.CompareAndSwapUint64(addr, cur, rangeBits(value)) {
+			return
+		}
+	}
+}
+
+// Min returns the smallest observed value, or NaN if there is none.
+func (v *Range) Min() float64 {
+	return rangeFloat(atomic.LoadUint64(&v.min))
+}
+
+// Max returns the largest observed value, or NaN if there is none.
+func (v *Range) Max() float64 {
+	return rangeFloat(atomic.LoadUint64(&v.max))
+}
+
+// Count returns the number of observed values.
+func (v *Range) Count() uint64 {
+	return atomic.LoadUint64(&v.count)
+}
+
+func (v *Range) String() string {
+	return `{"min": ` + formatFloat(v.Min()) +
+		`, "max": ` + formatFloat(v.Max()) +
+		`, "count": ` + strconv.FormatUint(v.Count(), 10) + `}`
+}
+
+func (v *Range) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Range) clone() Var {
+	return &Range{
+		min:   atomic.LoadUint64(&v.min),
+		max:   atomic.LoadUint64(&v.max),
+		count: atomic.LoadUint64(&v.count),
+	}
+}
+
+func NewRange(name string) *Range {
+	return Default.NewRange(name)
+}
+
+func (m *Bucket) NewRange(name string) *Range {
+	if v, ok := m.Get(name).(*Range); ok {
+		return v
+	}
+
+	v := newRange()
+	m.publishNew(name, v)
+	return v
+}
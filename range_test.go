@@ -0,0 +1,69 @@
+package expvar
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	v := new(Bucket).NewRange("latency")
+	if got, want := v.String(), `{"min": null, "max": null, "count": 0}`; got != want {
+		t.Errorf("v.String() before Observe = %s, want %s", got, want)
+	}
+
+	var wg sync.WaitGroup
+	for _, x := range []float64{3, -2.5, 1, 7, -1, math.NaN()} {
+		wg.Add(1)
+		go func(x float64) {
+			defer wg.Done()
+			v.Observe(x)
+		}(x)
+	}
+	wg.Wait()
+
+	if got, want := v.String(), `{"min": -2.5, "max": 7, "count": 5}`; got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+	if v.Min() != -2.5 || v.Max() != 7 || v.Count() != 5 {
+		t.Errorf("Min, Max, Count = %v, %v, %d, want -2.5, 7, 5", v.Min(), v.Max(), v.Count())
+	}
+}
+
+func TestRangeZeroValue(t *testing.T) {
+	var v Range
+	if got, want := v.String(), `{"min": null, "max": null, "count": 0}`; got != want {
+		t.Errorf("v.String() of the zero value = %s, want %s", got, want)
+	}
+	v.Observe(5)
+	if got, want := v.String(), `{"min": 5, "max": 5, "count": 1}`; got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+}
+
+func TestRangeObserveConcurrent(t *testing.T) {
+	v := newRange()
+
+	const goroutines, perGoroutine = 20, 500
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				v.Observe(float64(i*perGoroutine + j))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := v.Min(); got != 0 {
+		t.Errorf("v.Min() = %v, want 0", got)
+	}
+	if got, want := v.Max(), float64(goroutines*perGoroutine-1); got != want {
+		t.Errorf("v.Max() = %v, want %v", got, want)
+	}
+	if got := v.Count(); got != goroutines*perGoroutine {
+		t.Errorf("v.Count() = %d, want %d", got, goroutines*perGoroutine)
+	}
+}
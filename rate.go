@@ -0,0 +1,95 @@
+package expvar
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rate is a variable reporting the per-second rate of change of an Int,
+// and satisfies the Var interface. The source is sampled once every window
+// by a background goroutine, which runs until Stop is called.
+type Rate struct {
+	f uint64 // float64 bits of the last computed rate
+
+	source *Int
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newRate(source *Int, window time.Duration) *Rate {
+	if source == nil {
+		panic("expvar: Rate source must not be nil")
+	}
+	if window <= 0 {
+		panic("expvar: Rate window must be positive")
+	}
+	return &Rate{
+		source: source,
+		done:   make(chan struct{}),
+	}
+}
+
+// run samples the source every window until Stop is called. newRate does
+// not start it, so that a Rate that fails to publish leaves no goroutine
+// behind.
+func (v *Rate) run(window time.Duration) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	last, lastTime := v.source.Value(), time.Now()
+	for {
+		select {
+		case <-v.done:
+			return
+		case now := <-ticker.C:
+			cur := v.source.Value()
+			rate := float64(cur-last) / now.Sub(lastTime).Seconds()
+			atomic.StoreUint64(&v.f, math.Float64bits(rate))
+			last, lastTime = cur, now
+		}
+	}
+}
+
+// Value returns the rate per second computed over the last window.
+func (v *Rate) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.f))
+}
+
+func (v *Rate) String() string {
+	return formatFloat(v.Value())
+}
+
+// NumericValue returns the rate per second computed over the last window.
+func (v *Rate) NumericValue() float64 {
+	return v.Value()
+}
+
+func (v *Rate) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// Stop stops sampling the source. The last computed rate is kept.
+func (v *Rate) Stop() {
+	v.once.Do(func() {
+		close(v.done)
+	})
+}
+
+// NewRate creates and publishes a Rate that samples source every window.
+// It panics if source is nil or window is not positive.
+func NewRate(name string, source *Int, window time.Duration) *Rate {
+	return Default.NewRate(name, source, window)
+}
+
+func (m *Bucket) NewRate(name string, source *Int, window time.Duration) *Rate {
+	if v, ok := m.Get(name).(*Rate); ok {
+		return v
+	}
+
+	v := newRate(source, window)
+	m.publishNew(name, v)
+	go v.run(window)
+	return v
+}
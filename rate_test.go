@@ -0,0 +1,74 @@
+package expvar
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	source := new(Int)
+	b := new(Bucket)
+	v := b.NewRate("requests_per_second", source, 100*time.Millisecond)
+	defer v.Stop()
+
+	// Increment the source at 1000 per second for a few windows.
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.Now().Add(350 * time.Millisecond)
+	start := time.Now()
+	for now := range ticker.C {
+		source.Set(now.Sub(start).Milliseconds())
+		if now.After(deadline) {
+			break
+		}
+	}
+
+	if got := v.Value(); math.Abs(got-1000) > 200 {
+		t.Errorf("v.Value() = %v, want 1000 within 200", got)
+	}
+}
+
+func TestRateStop(t *testing.T) {
+	v := new(Bucket).NewRate("rate", new(Int), time.Millisecond)
+	v.Stop()
+	v.Stop() // Stop may be called more than once.
+}
+
+func TestRateDuplicate(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("rate")
+	before := runtime.NumGoroutine()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("NewRate of an Int name did not panic")
+			}
+		}()
+		b.NewRate("rate", new(Int), time.Millisecond)
+	}()
+	waitGoroutines(t, before)
+}
+
+func TestRateInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *Int
+		window time.Duration
+	}{
+		{"nil source", nil, time.Second},
+		{"zero window", new(Int), 0},
+		{"negative window", new(Int), -time.Second},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: NewRate did not panic", tt.name)
+				}
+			}()
+			new(Bucket).NewRate("rate", tt.source, tt.window)
+		}()
+	}
+}
@@ -0,0 +1,122 @@
+package expvar
+
+import (
+	"strings"
+	"sync"
+)
+
+// RingBuffer is a variable holding the most recent float64 samples added to
+// it, and satisfies the Var interface. It is rendered as a JSON array with
+// the oldest sample first.
+//
+// The zero value has no room for samples and must not be used; create a
+// RingBuffer with NewRingBuffer or Bucket.NewRingBuffer.
+type RingBuffer struct {
+	mu      sync.Mutex
+	samples []float64
+	ring    ring
+}
+
+func newRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		panic("expvar: RingBuffer size must be positive")
+	}
+	return &RingBuffer{samples: make([]float64, size), ring: ring{size: size}}
+}
+
+// Add adds a sample, replacing the oldest one if the buffer is full.
+func (v *RingBuffer) Add(sample float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples[v.ring.add()] = sample
+}
+
+// Value returns a copy of the samples, oldest first.
+func (v *RingBuffer) Value() []float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	samples := make([]float64, v.ring.len())
+	for i := range samples {
+		samples[i] = v.samples[v.ring.index(i)]
+	}
+	return samples
+}
+
+func (v *RingBuffer) String() string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, f := range v.Value() {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(formatFloat(f))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func (v *RingBuffer) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *RingBuffer) clone() Var {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return &RingBuffer{
+		samples: append([]float64(nil), v.samples...),
+		ring:    v.ring,
+	}
+}
+
+// ring tracks the elements of a fixed size circular buffer, which is kept
+// in a slice of that size by the var using it. RingBuffer and TimeSeries
+// share it.
+type ring struct {
+	size int
+	next int  // index the next element is written to
+	full bool // whether the buffer has wrapped around
+}
+
+// add returns the index to write a new element to, which replaces the
+// oldest one if the buffer is full.
+func (r *ring) add() int {
+	i := r.next
+	r.next++
+	if r.next == r.size {
+		r.next = 0
+		r.full = true
+	}
+	return i
+}
+
+// len returns the number of elements in the buffer.
+func (r *ring) len() int {
+	if r.full {
+		return r.size
+	}
+	return r.next
+}
+
+// index returns the index of the i'th oldest element.
+func (r *ring) index(i int) int {
+	if !r.full {
+		return i
+	}
+	return (r.next + i) % r.size
+}
+
+// NewRingBuffer creates and publishes a RingBuffer holding the last size
+// samples. It panics if size is not positive.
+func NewRingBuffer(name string, size int) *RingBuffer {
+	return Default.NewRingBuffer(name, size)
+}
+
+func (m *Bucket) NewRingBuffer(name string, size int) *RingBuffer {
+	if v, ok := m.Get(name).(*RingBuffer); ok {
+		return v
+	}
+
+	v := newRingBuffer(size)
+	m.publishNew(name, v)
+	return v
+}
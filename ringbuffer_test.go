@@ -0,0 +1,38 @@
+package expvar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewRingBuffer("latency", 3)
+	if got := v.String(); got != "[]" {
+		t.Errorf("v.String() = %s, want []", got)
+	}
+
+	v.Add(1)
+	v.Add(2)
+	if got := v.String(); got != "[1, 2]" {
+		t.Errorf("v.String() = %s, want [1, 2]", got)
+	}
+
+	v.Add(3)
+	v.Add(4)
+	if got, want := v.Value(), []float64{2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("v.Value() = %v, want %v", got, want)
+	}
+	if got := v.String(); got != "[2, 3, 4]" {
+		t.Errorf("v.String() = %s, want [2, 3, 4]", got)
+	}
+}
+
+func TestRingBufferInvalidSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewRingBuffer with size 0 did not panic")
+		}
+	}()
+	new(Bucket).NewRingBuffer("latency", 0)
+}
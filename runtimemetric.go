@@ -0,0 +1,79 @@
+//go:build go1.16
+// +build go1.16
+
+package expvar
+
+import (
+	"runtime/metrics"
+	"strconv"
+)
+
+// RuntimeMetric is a variable that reads a single runtime/metrics sample
+// each time it is rendered. It satisfies the Var interface. It requires Go
+// 1.16 or later.
+type RuntimeMetric struct {
+	name string
+}
+
+func newRuntimeMetric(metricName string) *RuntimeMetric {
+	for _, d := range metrics.All() {
+		if d.Name != metricName {
+			continue
+		}
+		if d.Kind != metrics.KindUint64 && d.Kind != metrics.KindFloat64 {
+			panic("expvar: runtime metric " + metricName + " is not a scalar")
+		}
+		return &RuntimeMetric{name: metricName}
+	}
+	panic("expvar: unknown runtime metric " + metricName)
+}
+
+func (v *RuntimeMetric) read() metrics.Value {
+	s := []metrics.Sample{{Name: v.name}}
+	metrics.Read(s)
+	return s[0].Value
+}
+
+// Value returns the current value of the metric.
+func (v *RuntimeMetric) Value() float64 {
+	val := v.read()
+	if val.Kind() == metrics.KindUint64 {
+		return float64(val.Uint64())
+	}
+	return val.Float64()
+}
+
+// NumericValue returns the current value of the metric.
+func (v *RuntimeMetric) NumericValue() float64 {
+	return v.Value()
+}
+
+func (v *RuntimeMetric) String() string {
+	val := v.read()
+	if val.Kind() == metrics.KindUint64 {
+		return strconv.FormatUint(val.Uint64(), 10)
+	}
+	return formatFloat(val.Float64())
+}
+
+func (v *RuntimeMetric) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// NewRuntimeMetric creates and publishes a variable exposing the
+// runtime/metrics sample metricName, such as
+// "/sched/goroutines:goroutines". It panics if the metric is not supported
+// by the runtime or is not a scalar.
+func NewRuntimeMetric(name, metricName string) Var {
+	return Default.NewRuntimeMetric(name, metricName)
+}
+
+func (m *Bucket) NewRuntimeMetric(name, metricName string) Var {
+	if v, ok := m.Get(name).(*RuntimeMetric); ok {
+		return v
+	}
+
+	v := newRuntimeMetric(metricName)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,40 @@
+//go:build go1.16
+// +build go1.16
+
+package expvar
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRuntimeMetric(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewRuntimeMetric("goroutines", "/sched/goroutines:goroutines")
+
+	n, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil || n <= 0 {
+		t.Errorf("v.String() = %q, want a positive integer", v.String())
+	}
+	if got := b.NewRuntimeMetric("goroutines", "/sched/goroutines:goroutines"); got != v {
+		t.Errorf("second NewRuntimeMetric returned %v, want the published var", got)
+	}
+}
+
+func TestRuntimeMetricUnknown(t *testing.T) {
+	b := new(Bucket)
+	want := "expvar: unknown runtime metric /no/such:metric"
+	if got := panicMessage(func() { b.NewRuntimeMetric("x", "/no/such:metric") }); got != want {
+		t.Errorf("panic = %q, want %q", got, want)
+	}
+	if b.Get("x") != nil {
+		t.Error("unknown metric was published")
+	}
+}
+
+func TestRuntimeMetricNumericValue(t *testing.T) {
+	v := newRuntimeMetric("/sched/goroutines:goroutines")
+	if got, ok := AsFloat(v); !ok || got < 1 {
+		t.Errorf("AsFloat(v) = %v, %v, want at least 1, true", got, ok)
+	}
+}
@@ -0,0 +1,131 @@
+package expvar
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a variable estimating percentiles of a stream of values from a
+// uniform random sample of fixed size, and satisfies the Var interface. It
+// is rendered as {"count": n, "p50": x, "p95": x, "p99": x}, where count is
+// the number of values seen and the percentiles are null until the first
+// update.
+//
+// The zero value has no reservoir and must not be used; create a Sample with
+// NewSample or Bucket.NewSample.
+type Sample struct {
+	mu        sync.Mutex
+	count     uint64
+	reservoir []float64
+	rand      *rand.Rand
+}
+
+func newSample(size int) *Sample {
+	if size <= 0 {
+		panic("expvar: Sample reservoir size must be positive")
+	}
+	return &Sample{
+		reservoir: make([]float64, 0, size),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Update adds value to the stream, keeping it in the sample with a
+// probability that keeps the sample uniform (Vitter's Algorithm R).
+func (v *Sample) Update(value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.count++
+	if len(v.reservoir) < cap(v.reservoir) {
+		v.reservoir = append(v.reservoir, value)
+		return
+	}
+	if i := v.rand.Int63n(int64(v.count)); i < int64(len(v.reservoir)) {
+		v.reservoir[i] = value
+	}
+}
+
+// Count returns the number of values added.
+func (v *Sample) Count() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.count
+}
+
+// Percentile returns an estimate of the p-th percentile, with p in [0, 100],
+// of the values added. It returns NaN if no value has been added.
+func (v *Sample) Percentile(p float64) float64 {
+	_, values := v.snapshot()
+	return percentile(values, p)
+}
+
+// snapshot returns the number of values added and a sorted copy of the
+// reservoir.
+func (v *Sample) snapshot() (uint64, []float64) {
+	v.mu.Lock()
+	count := v.count
+	values := append([]float64(nil), v.reservoir...)
+	v.mu.Unlock()
+
+	sort.Float64s(values)
+	return count, values
+}
+
+// percentile returns the p-th percentile of sorted, interpolating between
+// the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo < 0 {
+		return sorted[0]
+	}
+	if hi >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+func (v *Sample) String() string {
+	count, values := v.snapshot()
+	return fmt.Sprintf("{\"count\": %d, \"p50\": %s, \"p95\": %s, \"p99\": %s}", count,
+		formatFloat(percentile(values, 50)),
+		formatFloat(percentile(values, 95)),
+		formatFloat(percentile(values, 99)))
+}
+
+func (v *Sample) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Sample) clone() Var {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c := newSample(cap(v.reservoir))
+	c.count = v.count
+	c.reservoir = append(c.reservoir, v.reservoir...)
+	return c
+}
+
+// NewSample creates and publishes a Sample keeping reservoirSize values. It
+// panics if reservoirSize is not positive.
+func NewSample(name string, reservoirSize int) *Sample {
+	return Default.NewSample(name, reservoirSize)
+}
+
+func (m *Bucket) NewSample(name string, reservoirSize int) *Sample {
+	if v, ok := m.Get(name).(*Sample); ok {
+		return v
+	}
+
+	v := newSample(reservoirSize)
+	m.publishNew(name, v)
+	return v
+}
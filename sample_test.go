@@ -0,0 +1,78 @@
+package expvar
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSamplePercentiles(t *testing.T) {
+	v := newSample(1000)
+	// Use a fixed seed so the sampled percentiles are deterministic.
+	v.rand = rand.New(rand.NewSource(1))
+	// Feed a uniform distribution over [0, 1000) many times over, so the
+	// reservoir holds a uniform sample of it.
+	for i := 0; i < 100000; i++ {
+		v.Update(float64(i % 1000))
+	}
+
+	if got := v.Count(); got != 100000 {
+		t.Errorf("v.Count() = %d, want 100000", got)
+	}
+	for _, p := range []float64{50, 95, 99} {
+		if got, want := v.Percentile(p), p*10; math.Abs(got-want) > 40 {
+			t.Errorf("v.Percentile(%v) = %v, want %v ± 40", p, got, want)
+		}
+	}
+
+	var doc map[string]float64
+	if err := json.Unmarshal([]byte(v.String()), &doc); err != nil {
+		t.Fatalf("invalid JSON %s: %v", v.String(), err)
+	}
+	for _, key := range []string{"count", "p50", "p95", "p99"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("v.String() = %s, missing %q", v.String(), key)
+		}
+	}
+}
+
+func TestSampleEmpty(t *testing.T) {
+	v := newSample(10)
+	if got := v.Percentile(50); !math.IsNaN(got) {
+		t.Errorf("v.Percentile(50) = %v, want NaN", got)
+	}
+	want := `{"count": 0, "p50": null, "p95": null, "p99": null}`
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+}
+
+func TestSampleUpdateConcurrent(t *testing.T) {
+	v := newSample(100)
+
+	const goroutines, perGoroutine = 20, 500
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				v.Update(float64(j))
+				_ = v.String()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := v.Count(); got != goroutines*perGoroutine {
+		t.Errorf("v.Count() = %d, want %d", got, goroutines*perGoroutine)
+	}
+}
+
+func TestNewSampleInvalidSize(t *testing.T) {
+	if msg := panicMessage(func() { newSample(0) }); msg == "" {
+		t.Error("newSample(0) did not panic")
+	}
+}
@@ -0,0 +1,89 @@
+package expvar
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// schemaDialect is the JSON Schema dialect served by SchemaHandler.
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaType returns the JSON Schema type of the value of v, either a
+// single type name or a list of them. It returns nil if v does not produce
+// valid JSON.
+func schemaType(v Var) interface{} {
+	switch v.(type) {
+	case *Int, *DeltaInt, *ShardedInt, *Counter:
+		return "integer"
+	case *Float, *Gauge, *EWMA, *Rate:
+		// NaN and infinite values are rendered as null.
+		return []string{"number", "null"}
+	case *String, *Duration, *Timestamp:
+		return "string"
+	case *Bool:
+		return "boolean"
+	case *Map:
+		return "object"
+	}
+
+	dec := json.NewDecoder(strings.NewReader(v.String()))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil
+	}
+	switch val := val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(val.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// SchemaHandler returns an HTTP Handler that serves a JSON Schema (draft
+// 2020-12) describing the document served for m. The schema lists every
+// variable currently exported, with its type inferred from its current
+// value. Floating point vars are typed as number or null, since NaN and
+// infinite values are rendered as null.
+func SchemaHandler(m *Bucket) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		properties := make(map[string]interface{})
+		required := []string{}
+		m.doVisible(func(kv KeyValue) {
+			if typ := schemaType(kv.Value); typ != nil {
+				properties[kv.Key] = map[string]interface{}{"type": typ}
+				required = append(required, kv.Key)
+			}
+		})
+
+		schema := map[string]interface{}{
+			"$schema":    schemaDialect,
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(schema); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/schema+json")
+		buf.WriteTo(w)
+	})
+}
@@ -0,0 +1,70 @@
+package expvar
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaHandler(t *testing.T) {
+	b := new(Bucket)
+	b.NewInt("int")
+	b.NewCounter("counter")
+	b.NewFloat("float")
+	b.NewGauge("gauge").Set(1.5)
+	b.NewEWMA("ewma", 0.5)
+	b.NewString("string")
+	b.NewBool("bool")
+	b.NewMap("map")
+	b.Publish("array", Func(func() interface{} { return []int{1} }))
+	b.Publish("integer", Func(func() interface{} { return 1 }))
+	b.Publish("number", Func(func() interface{} { return 1.5 }))
+	b.Publish("null", Func(func() interface{} { return nil }))
+	b.Publish("invalid", rawVar("{"))
+
+	w := serve(SchemaHandler(b), "/")
+	if ct := w.Header().Get("Content-Type"); ct != "application/schema+json" {
+		t.Errorf("Content-Type = %q, want application/schema+json", ct)
+	}
+
+	var schema struct {
+		Schema     string `json:"$schema"`
+		Type       string
+		Properties map[string]struct {
+			Type interface{}
+		}
+		Required []string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("invalid schema %s: %v", w.Body.Bytes(), err)
+	}
+	if schema.Schema != schemaDialect || schema.Type != "object" {
+		t.Errorf("$schema, type = %q, %q, want %q, object", schema.Schema, schema.Type, schemaDialect)
+	}
+
+	number := []interface{}{"number", "null"}
+	want := map[string]interface{}{
+		"int":     "integer",
+		"counter": "integer",
+		"float":   number,
+		"gauge":   number,
+		"ewma":    number,
+		"string":  "string",
+		"bool":    "boolean",
+		"map":     "object",
+		"array":   "array",
+		"integer": "integer",
+		"number":  "number",
+		"null":    "null",
+	}
+	got := make(map[string]interface{})
+	for name, p := range schema.Properties {
+		got[name] = p.Type
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("property types = %v, want %v", got, want)
+	}
+	if len(schema.Required) != len(want) {
+		t.Errorf("required = %v, want the %d properties", schema.Required, len(want))
+	}
+}
@@ -0,0 +1,102 @@
+package expvar
+
+import (
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheLinePad is the padding between ShardedInt shards, so that each shard
+// occupies its own cache line.
+const cacheLinePad = 64
+
+type intShard struct {
+	i int64
+	_ [cacheLinePad - 8]byte
+}
+
+// ShardedInt is a 64-bit integer variable that satisfies the Var interface
+// and renders like an Int. It spreads updates over one counter per
+// GOMAXPROCS to avoid contention on a single cache line, at the cost of a
+// slower Value, which has to sum all shards.
+type ShardedInt struct {
+	once   sync.Once
+	shards []intShard
+	next   uint32
+	hints  sync.Pool // *int shard index, mostly local to the current P
+}
+
+func (v *ShardedInt) init() {
+	v.shards = make([]intShard, runtime.GOMAXPROCS(0))
+	v.hints.New = func() interface{} {
+		i := int(atomic.AddUint32(&v.next, 1)) % len(v.shards)
+		return &i
+	}
+}
+
+func (v *ShardedInt) Value() int64 {
+	v.once.Do(v.init)
+	var n int64
+	for i := range v.shards {
+		n += atomic.LoadInt64(&v.shards[i].i)
+	}
+	return n
+}
+
+func (v *ShardedInt) String() string {
+	return strconv.FormatInt(v.Value(), 10)
+}
+
+// NumericValue returns the value of v as a float64.
+func (v *ShardedInt) NumericValue() float64 {
+	return float64(v.Value())
+}
+
+func (v *ShardedInt) Increment() {
+	v.Add(1)
+}
+
+func (v *ShardedInt) Decrement() {
+	v.Add(-1)
+}
+
+func (v *ShardedInt) Add(delta int64) {
+	v.once.Do(v.init)
+	hint := v.hints.Get().(*int)
+	atomic.AddInt64(&v.shards[*hint].i, delta)
+	v.hints.Put(hint)
+}
+
+// Zero sets v to zero. Adds that happen concurrently may be lost.
+func (v *ShardedInt) Zero() {
+	v.once.Do(v.init)
+	for i := range v.shards {
+		atomic.StoreInt64(&v.shards[i].i, 0)
+	}
+}
+
+func (v *ShardedInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value())
+}
+
+func (v *ShardedInt) clone() Var {
+	c := new(ShardedInt)
+	c.Add(v.Value())
+	return c
+}
+
+func NewShardedInt(name string) *ShardedInt {
+	return Default.NewShardedInt(name)
+}
+
+func (m *Bucket) NewShardedInt(name string) *ShardedInt {
+	if v, ok := m.Get(name).(*ShardedInt); ok {
+		return v
+	}
+
+	v := new(ShardedInt)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,55 @@
+package expvar
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestShardedIntConcurrent(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewShardedInt("requests")
+
+	const goroutines, adds = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				v.Increment()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := v.Value(); got != goroutines*adds {
+		t.Errorf("v.Value() = %d, want %d", got, goroutines*adds)
+	}
+	v.Decrement()
+	if got, want := v.String(), "7999"; got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+
+	v.Zero()
+	if got := v.Value(); got != 0 {
+		t.Errorf("v.Value() after Zero = %d, want 0", got)
+	}
+}
+
+func BenchmarkIntAddParallel(b *testing.B) {
+	v := new(Int)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v.Add(1)
+		}
+	})
+}
+
+func BenchmarkShardedIntAddParallel(b *testing.B) {
+	v := new(ShardedInt)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v.Add(1)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package expvar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SSEHandler returns an HTTP Handler that streams the variables of m as
+// server-sent events. Right away and then every interval, it sends an event
+// whose data is the JSON object MarshalJSON returns for m. The stream ends
+// when the client disconnects. It panics if interval is not positive.
+func SSEHandler(m *Bucket, interval time.Duration) http.Handler {
+	if interval <= 0 {
+		panic("expvar: SSEHandler interval must be positive")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := writeEvent(w, m); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// writeEvent writes the variables of m as a single server-sent event.
+func writeEvent(w http.ResponseWriter, m *Bucket) error {
+	b, _ := m.MarshalJSON()
+
+	// An event's data must not contain newlines.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "data: %s\n\n", buf.Bytes())
+	return err
+}
@@ -0,0 +1,72 @@
+package expvar
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEHandler(t *testing.T) {
+	b := new(Bucket)
+	requests := b.NewInt("requests")
+
+	before := runtime.NumGoroutine()
+	srv := httptest.NewServer(SSEHandler(b, 10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", srv.URL, err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	for events := 0; events < 2; {
+		if !sc.Scan() {
+			t.Fatalf("stream ended after %d events: %v", events, sc.Err())
+		}
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			t.Fatalf("line %q, want a data line", line)
+		}
+		var doc map[string]int
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &doc); err != nil {
+			t.Fatalf("event %q is not a JSON object: %v", line, err)
+		}
+		if _, ok := doc["requests"]; !ok {
+			t.Errorf("event %q has no requests member", line)
+		}
+		events++
+		requests.Add(1)
+	}
+
+	cancel()
+	resp.Body.Close()
+	srv.Close()
+	http.DefaultClient.CloseIdleConnections()
+	waitGoroutines(t, before)
+}
+
+func TestSSEHandlerInvalidInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SSEHandler with a zero interval did not panic")
+		}
+	}()
+	SSEHandler(new(Bucket), 0)
+}
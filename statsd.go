@@ -0,0 +1,94 @@
+package expvar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxStatsDPacket is the largest UDP payload sent to StatsD, chosen to fit
+// in a single Ethernet frame.
+const maxStatsDPacket = 1432
+
+// PushStatsD starts sending the numeric variables of m to the StatsD server
+// at addr over UDP every interval, until ctx is done. Each var is sent as a
+// gauge named prefix.name, and the numeric entries of a Map as
+// prefix.name.key. If prefix is empty the names are sent as is. The options
+// can add jitter and backoff to the interval. It panics if interval is not
+// positive.
+//
+// PushStatsD returns as soon as the pusher is running in the background, or
+// with an error if addr cannot be resolved. Failed sends are not reported;
+// StatsD is fire and forget, and the next push sends fresh values. Earlier
+// versions returned a stop func instead; cancel ctx to stop pushing.
+func PushStatsD(ctx context.Context, m *Bucket, addr string, interval time.Duration, prefix string, opts ...PushOption) error {
+	sched := newPushSchedule(interval, opts)
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	go pushStatsD(ctx, conn, m, prefix, sched)
+	return nil
+}
+
+// pushStatsD sends the packets of m to conn following sched until ctx is
+// done, and then closes conn.
+func pushStatsD(ctx context.Context, conn net.Conn, m *Bucket, prefix string, sched *pushSchedule) {
+	defer conn.Close()
+
+	timer := time.NewTimer(sched.next(nil))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			var err error
+			for _, packet := range statsDPackets(m, prefix) {
+				if _, werr := conn.Write(packet); werr != nil && err == nil {
+					err = werr
+				}
+			}
+			timer.Reset(sched.next(err))
+		}
+	}
+}
+
+// statsDPackets renders the numeric variables of m as StatsD gauge lines,
+// split into packets of at most maxStatsDPacket bytes.
+func statsDPackets(m *Bucket, prefix string) [][]byte {
+	if prefix != "" {
+		prefix += "."
+	}
+
+	var packets [][]byte
+	var buf bytes.Buffer
+	for _, family := range collectMetrics(m) {
+		for _, s := range family.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			name := prefix + family.Name
+			if s.Key != "" {
+				name += "." + s.Key
+			}
+			line := fmt.Sprintf("%s:%s|g", name, strconv.FormatFloat(s.Value, 'g', -1, 64))
+			if buf.Len() > 0 && buf.Len()+1+len(line) > maxStatsDPacket {
+				packets = append(packets, append([]byte(nil), buf.Bytes()...))
+				buf.Reset()
+			}
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(line)
+		}
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
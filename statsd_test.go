@@ -0,0 +1,88 @@
+package expvar
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushStatsD(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket failed: %v", err)
+	}
+	defer pc.Close()
+
+	b := new(Bucket)
+	b.NewInt("requests").Set(3)
+	b.NewFloat("load").Set(0.5)
+	b.NewString("version").Set("1.0")
+	b.NewMap("codes").Add("200", 4)
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := PushStatsD(ctx, b, pc.LocalAddr().String(), 10*time.Millisecond, "app"); err != nil {
+		t.Fatalf("PushStatsD() = %v, want nil", err)
+	}
+
+	buf := make([]byte, maxStatsDPacket)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("reading packet failed: %v", err)
+	}
+	const want = "app.codes.200:4|g\napp.load:0.5|g\napp.requests:3|g"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("packet = %q, want %q", got, want)
+	}
+
+	cancel()
+	waitGoroutines(t, before)
+}
+
+func TestPushStatsDInvalidAddr(t *testing.T) {
+	if err := PushStatsD(context.Background(), new(Bucket), "invalid address", time.Second, ""); err == nil {
+		t.Errorf("PushStatsD() with an invalid address = nil, want an error")
+	}
+}
+
+// waitGoroutines waits for the number of goroutines to drop to n, and
+// fails the test if it does not within a few seconds.
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines running, want at most %d", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStatsDPacketsSplit(t *testing.T) {
+	b := new(Bucket)
+	m := b.NewMap("m")
+	for i := 0; i < 200; i++ {
+		m.Add(strconv.Itoa(i), int64(i))
+	}
+
+	packets := statsDPackets(b, "")
+	if len(packets) < 2 {
+		t.Fatalf("got %d packets, want more than one", len(packets))
+	}
+	lines := 0
+	for _, p := range packets {
+		if len(p) > maxStatsDPacket {
+			t.Errorf("packet of %d bytes, want at most %d", len(p), maxStatsDPacket)
+		}
+		lines += len(strings.Split(string(p), "\n"))
+	}
+	if lines != 200 {
+		t.Errorf("got %d lines, want 200", lines)
+	}
+}
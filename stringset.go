@@ -0,0 +1,92 @@
+package expvar
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// StringSet is a set of unique strings that satisfies the Var interface. It
+// is rendered as a sorted JSON array.
+type StringSet struct {
+	mu sync.RWMutex
+	m  map[string]struct{}
+}
+
+// Add adds s to the set.
+func (v *StringSet) Add(s string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.m == nil {
+		v.m = make(map[string]struct{})
+	}
+	v.m[s] = struct{}{}
+}
+
+// Remove removes s from the set.
+func (v *StringSet) Remove(s string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.m, s)
+}
+
+// Contains reports whether s is in the set.
+func (v *StringSet) Contains(s string) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	_, ok := v.m[s]
+	return ok
+}
+
+// Len returns the number of strings in the set.
+func (v *StringSet) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.m)
+}
+
+// Value returns the strings in the set, sorted.
+func (v *StringSet) Value() []string {
+	v.mu.RLock()
+	values := make([]string, 0, len(v.m))
+	for s := range v.m {
+		values = append(values, s)
+	}
+	v.mu.RUnlock()
+
+	sort.Strings(values)
+	return values
+}
+
+func (v *StringSet) String() string {
+	b, _ := json.Marshal(v.Value())
+	return string(b)
+}
+
+func (v *StringSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value())
+}
+
+func (v *StringSet) clone() Var {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	c := &StringSet{m: make(map[string]struct{}, len(v.m))}
+	for s := range v.m {
+		c.m[s] = struct{}{}
+	}
+	return c
+}
+
+func NewStringSet(name string) *StringSet {
+	return Default.NewStringSet(name)
+}
+
+func (m *Bucket) NewStringSet(name string) *StringSet {
+	if v, ok := m.Get(name).(*StringSet); ok {
+		return v
+	}
+
+	v := new(StringSet)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,36 @@
+package expvar
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStringSet(t *testing.T) {
+	b := new(Bucket)
+	v := b.NewStringSet("peers")
+	if got := v.String(); got != "[]" {
+		t.Errorf("v.String() of an empty set = %s, want []", got)
+	}
+
+	for _, s := range []string{"b", "a", "c", "a", `"q"`} {
+		v.Add(s)
+	}
+	if n := v.Len(); n != 4 {
+		t.Errorf("v.Len() = %d, want 4", n)
+	}
+
+	v.Remove("c")
+	v.Remove("missing")
+	if v.Contains("c") || !v.Contains("a") {
+		t.Errorf("v.Contains() after Remove: c = %v, a = %v, want false, true", v.Contains("c"), v.Contains("a"))
+	}
+
+	var got []string
+	if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+		t.Fatalf("v.String() = %s, not valid JSON: %v", v.String(), err)
+	}
+	if want := []string{`"q"`, "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("v.String() = %v, want %v", got, want)
+	}
+}
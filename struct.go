@@ -0,0 +1,58 @@
+package expvar
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Struct is a variable that renders the struct a pointer points to, and
+// satisfies the Var interface. The struct is marshaled each time the
+// variable is rendered, so it is a live view. Only exported fields are
+// included, following encoding/json. Struct does not synchronize with
+// writers of the struct; fields that change concurrently should be
+// protected by the caller or only be changed before publishing.
+type Struct struct {
+	ptr interface{}
+}
+
+func newStruct(ptr interface{}) *Struct {
+	t := reflect.TypeOf(ptr)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic("expvar: NewStruct requires a pointer to a struct")
+	}
+	return &Struct{ptr: ptr}
+}
+
+// String implements the Var interface. A nil pointer is rendered as null.
+// If the struct cannot be marshaled, it returns an object holding the
+// error, like {"error": "..."}.
+func (v *Struct) String() string {
+	if reflect.ValueOf(v.ptr).IsNil() {
+		return "null"
+	}
+	b, err := json.Marshal(v.ptr)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return string(b)
+}
+
+func (v *Struct) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// NewStruct creates and publishes a Struct rendering the struct ptr points
+// to. It panics if ptr is not a pointer to a struct.
+func NewStruct(name string, ptr interface{}) Var {
+	return Default.NewStruct(name, ptr)
+}
+
+func (m *Bucket) NewStruct(name string, ptr interface{}) Var {
+	if v, ok := m.Get(name).(*Struct); ok {
+		return v
+	}
+
+	v := newStruct(ptr)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,43 @@
+package expvar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStruct(t *testing.T) {
+	type config struct {
+		Name   string
+		Port   int `json:"port"`
+		secret string
+	}
+	c := &config{Name: "api", Port: 80, secret: "hunter2"}
+	v := new(Bucket).NewStruct("config", c)
+
+	if got, want := v.String(), `{"Name":"api","port":80}`; got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+	c.Port = 8080
+	if got, want := v.String(), `{"Name":"api","port":8080}`; got != want {
+		t.Errorf("v.String() after the change = %s, want %s", got, want)
+	}
+	if strings.Contains(v.String(), c.secret) {
+		t.Errorf("v.String() = %s exposes an unexported field", v.String())
+	}
+}
+
+func TestStructNilAndUnmarshalable(t *testing.T) {
+	var nilPtr *struct{ A int }
+	if got := newStruct(nilPtr).String(); got != "null" {
+		t.Errorf("nil pointer: String() = %s, want null", got)
+	}
+
+	withFunc := &struct{ F func() }{F: func() {}}
+	if got := newStruct(withFunc).String(); !strings.HasPrefix(got, `{"error":`) {
+		t.Errorf("unmarshalable struct: String() = %s, want an error object", got)
+	}
+
+	if msg := panicMessage(func() { newStruct(struct{}{}) }); msg == "" {
+		t.Error("newStruct of a non-pointer did not panic")
+	}
+}
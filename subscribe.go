@@ -0,0 +1,40 @@
+package expvar
+
+// subscriptionBuffer is the capacity of the channels returned by Subscribe.
+const subscriptionBuffer = 64
+
+// Subscribe returns a channel that receives the name of every variable
+// published in or unpublished from m, and a function that ends the
+// subscription and closes the channel. Delivery is best effort: names are
+// dropped when the channel is full, so that publishing never blocks.
+func (m *Bucket) Subscribe() (<-chan string, func()) {
+	c := make(chan string, subscriptionBuffer)
+
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	if m.subs == nil {
+		m.subs = make(map[chan string]struct{})
+	}
+	m.subs[c] = struct{}{}
+
+	return c, func() {
+		m.subsMu.Lock()
+		defer m.subsMu.Unlock()
+		if _, ok := m.subs[c]; ok {
+			delete(m.subs, c)
+			close(c)
+		}
+	}
+}
+
+// notify sends name to all subscribers of m that have room for it.
+func (m *Bucket) notify(name string) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	for c := range m.subs {
+		select {
+		case c <- name:
+		default:
+		}
+	}
+}
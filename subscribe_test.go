@@ -0,0 +1,45 @@
+package expvar
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	b := new(Bucket)
+	c, unsubscribe := b.Subscribe()
+
+	b.NewInt("requests")
+	b.Unpublish("requests")
+	for _, op := range []string{"Publish", "Unpublish"} {
+		select {
+		case name := <-c:
+			if name != "requests" {
+				t.Errorf("after %s got %q, want %q", op, name, "requests")
+			}
+		default:
+			t.Errorf("no name delivered after %s", op)
+		}
+	}
+
+	unsubscribe()
+	unsubscribe() // must not panic
+	if _, ok := <-c; ok {
+		t.Error("channel still open after unsubscribe")
+	}
+	b.NewInt("errors") // must not send on the closed channel
+}
+
+func TestSubscribeFullChannel(t *testing.T) {
+	b := new(Bucket)
+	c, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	// Publishing more vars than the channel holds must not block.
+	for i := 0; i < subscriptionBuffer+10; i++ {
+		b.NewInt(fmt.Sprintf("v%d", i))
+	}
+	if got := len(c); got != subscriptionBuffer {
+		t.Errorf("len(c) = %d, want %d", got, subscriptionBuffer)
+	}
+}
@@ -0,0 +1,101 @@
+package expvar
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimePoint is a single value of a TimeSeries.
+type TimePoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// TimeSeries is a variable holding the most recent timestamped values
+// recorded in it, and satisfies the Var interface. It is rendered as a
+// JSON array of [unixMillis, value] pairs with the oldest point first.
+type TimeSeries struct {
+	mu     sync.Mutex
+	points []TimePoint
+	ring   ring
+}
+
+func newTimeSeries(maxPoints int) *TimeSeries {
+	if maxPoints <= 0 {
+		panic("expvar: TimeSeries maxPoints must be positive")
+	}
+	return &TimeSeries{points: make([]TimePoint, maxPoints), ring: ring{size: maxPoints}}
+}
+
+// Record adds value with the current time, dropping the oldest point if
+// the series is full. The time is taken while v is locked, so that points
+// recorded concurrently stay in chronological order.
+func (v *TimeSeries) Record(value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.add(time.Now(), value)
+}
+
+// add adds value with time t. v.mu must be held.
+func (v *TimeSeries) add(t time.Time, value float64) {
+	v.points[v.ring.add()] = TimePoint{t, value}
+}
+
+// Value returns a copy of the points, oldest first.
+func (v *TimeSeries) Value() []TimePoint {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	points := make([]TimePoint, v.ring.len())
+	for i := range points {
+		points[i] = v.points[v.ring.index(i)]
+	}
+	return points
+}
+
+func (v *TimeSeries) String() string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, p := range v.Value() {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("[")
+		b.WriteString(strconv.FormatInt(p.Time.UnixNano()/int64(time.Millisecond), 10))
+		b.WriteString(", ")
+		b.WriteString(formatFloat(p.Value))
+		b.WriteString("]")
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func (v *TimeSeries) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *TimeSeries) clone() Var {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return &TimeSeries{
+		points: append([]TimePoint(nil), v.points...),
+		ring:   v.ring,
+	}
+}
+
+// NewTimeSeries creates and publishes a TimeSeries holding the last
+// maxPoints points. It panics if maxPoints is not positive.
+func NewTimeSeries(name string, maxPoints int) *TimeSeries {
+	return Default.NewTimeSeries(name, maxPoints)
+}
+
+func (m *Bucket) NewTimeSeries(name string, maxPoints int) *TimeSeries {
+	if v, ok := m.Get(name).(*TimeSeries); ok {
+		return v
+	}
+
+	v := newTimeSeries(maxPoints)
+	m.publishNew(name, v)
+	return v
+}
@@ -0,0 +1,61 @@
+package expvar
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordAt adds value to v with time t instead of the current time.
+func recordAt(v *TimeSeries, t time.Time, value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.add(t, value)
+}
+
+func TestTimeSeriesEviction(t *testing.T) {
+	v := newTimeSeries(3)
+	base := time.Unix(100, 0)
+	for i := 0; i < 5; i++ {
+		recordAt(v, base.Add(time.Duration(i)*time.Second), float64(i))
+	}
+
+	want := "[[102000, 2], [103000, 3], [104000, 4]]"
+	if got := v.String(); got != want {
+		t.Errorf("v.String() = %s, want %s", got, want)
+	}
+	if got := len(v.Value()); got != 3 {
+		t.Errorf("len(v.Value()) = %d, want 3", got)
+	}
+}
+
+func TestTimeSeriesRecordConcurrent(t *testing.T) {
+	v := newTimeSeries(50)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				v.Record(float64(j))
+				_ = v.String()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var points [][]float64
+	if err := json.Unmarshal([]byte(v.String()), &points); err != nil {
+		t.Fatalf("invalid JSON %s: %v", v.String(), err)
+	}
+	if len(points) != 50 {
+		t.Fatalf("%d points, want 50", len(points))
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i][0] < points[i-1][0] {
+			t.Fatalf("points out of order at %d: %v", i, points)
+		}
+	}
+}